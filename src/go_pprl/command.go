@@ -0,0 +1,1315 @@
+package main;
+
+import "bufio";
+import "bytes";
+import "context";
+import "crypto/ed25519";
+import "encoding/json";
+import "errors";
+import "flag";
+import "fmt";
+import "io";
+import "log";
+import "math/bits";
+import "net";
+import "net/http";
+import "os";
+import "os/signal";
+import "path/filepath";
+import "strconv";
+import "strings";
+import "time";
+
+import "pprl";
+
+/* parse flags of a subcommand, returns exit code if it should stop */
+func parse_flags(fs *flag.FlagSet, args []string) (int, bool) {
+  if err := fs.Parse(args); err != nil {
+    if errors.Is(err, flag.ErrHelp) {
+      return _exit_ok, false;
+    }
+    return _exit_usage, false;
+  }
+  if fs.NArg() > 0 {
+    log.Printf("[%s] unexpected arguments: %v\n", os.Args[0], fs.Args());
+    return _exit_usage, false;
+  }
+  return _exit_ok, true;
+}
+
+/* validate-config: read and check config only */
+func cmd_validate(args []string) (int) {
+  var o options;
+  var data bool;
+  fs := new_flags("validate-config", &o);
+  fs.BoolVar(&data, "data", true, "open datasets to check line counts against size and head lines against num_field");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  problems, err := pprl.ValidateConfig(o.conf, o.set, data);
+  if err != nil {
+    fmt.Printf("%s: invalid: %s\n", o.conf, err.Error());
+    return _exit_config;
+  }
+  code := _exit_ok;
+  for _, p := range problems {
+    fmt.Printf("%s: %s\n", o.conf, p.String());
+    if !p.Warning {
+      code = _exit_config;
+    }
+  }
+  if code == _exit_ok {
+    fmt.Printf("%s: ok\n", o.conf);
+  }
+  return code;
+}
+
+/* config: print the config as it is used, overrides applied and defaults filled in */
+func cmd_config(args []string) (int) {
+  var o options;
+  fs := new_flags("config", &o);
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  conf, err := pprl.LoadConfig(o.conf, o.set, o.debug);
+  if err != nil {
+    log.Printf("[%s] invalid config %s: %s\n", os.Args[0], o.conf, err.Error());
+    return _exit_config;
+  }
+  if err = conf.WriteJSON(os.Stdout); err != nil {
+    log.Printf("[%s] failed to print config: %s\n", os.Args[0], err.Error());
+    return _exit_output;
+  }
+  return _exit_ok;
+}
+
+/* profile: field statistics of datasets */
+func cmd_profile(args []string) (int) {
+  var o options;
+  var top int;
+  var as_json bool;
+  fs := new_flags("profile", &o);
+  fs.IntVar(&top, "top", 5, "#most frequent values of each field");
+  fs.BoolVar(&as_json, "json", false, "print report as JSON");
+  fs.StringVar(&o.out, "out", "", "path to report, stdout if empty");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  conf, code := init_conf(ctx, &o);
+  if code != _exit_ok {
+    return code;
+  }
+  if err := conf.Analyze(ctx); err != nil {
+    log.Printf("[%s] failed to analyze datasets: %s\n", os.Args[0], err.Error());
+    return exit_code(err, _exit_failure);
+  }
+  profile, err := conf.Profile(top);
+  if err != nil {
+    log.Printf("[%s] failed to profile datasets: %s\n", os.Args[0], err.Error());
+    return _exit_failure;
+  }
+  w := os.Stdout;
+  if o.out != "" {
+    if w, err = os.Create(o.out); err != nil {
+      log.Printf("[%s] failed to create %s: %s\n", os.Args[0], o.out, err.Error());
+      return _exit_output;
+    }
+    defer w.Close();
+  }
+  if as_json {
+    encoder := json.NewEncoder(w);
+    encoder.SetIndent("", "  ");
+    err = encoder.Encode(profile);
+  } else {
+    profile.Print(w);
+  }
+  if err != nil {
+    log.Printf("[%s] failed to write report: %s\n", os.Args[0], err.Error());
+    return _exit_output;
+  }
+  return _exit_ok;
+}
+
+/* plan: encoding parameters of each field */
+func cmd_plan(args []string) (int) {
+  var o options;
+  fs := new_flags("plan", &o);
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  conf, code := init_conf(ctx, &o);
+  if code != _exit_ok {
+    return code;
+  }
+  plan, err := conf.MakePlan(ctx);
+  if err != nil {
+    log.Printf("[%s] failed to plan encoding: %s\n", os.Args[0], err.Error());
+    return exit_code(err, _exit_config);
+  }
+  plan.Print(os.Stdout);
+  return _exit_ok;
+}
+
+/* encode: write bloom filters of each dataset */
+func cmd_encode(args []string) (int) {
+  var o options;
+  fs := new_flags("encode", &o);
+  fs.StringVar(&o.out, "out", "", "prefix of encoded output, dataset i is written to <prefix>.<i> (required)");
+  fs.StringVar(&o.format, "format", _format_text, "encoded output format: text or binary");
+  var sign string;
+  fs.StringVar(&sign, "sign", "", "signing key, a signed manifest <prefix>.<i>" + _manifest_suffix + " is written for each dataset");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  if o.out == "" {
+    log.Printf("[%s] encode: -out is required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  var key ed25519.PrivateKey;
+  if sign != "" {
+    var err error;
+    if key, err = read_signing_key(sign); err != nil {
+      log.Printf("[%s] failed to read signing key %s: %s\n", os.Args[0], sign, err.Error());
+      return _exit_usage;
+    }
+  }
+  if o.format != _format_text && o.format != _format_binary {
+    log.Printf("[%s] encode: unknown format %s\n", os.Args[0], o.format);
+    return _exit_usage;
+  }
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  conf, code := init_conf(ctx, &o);
+  if code != _exit_ok {
+    return code;
+  }
+  if err := conf.PrepareDatasetContext(ctx); err != nil {
+    log.Printf("[%s] failed to prepare dataset: %s\n", os.Args[0], err.Error());
+    return exit_code(err, _exit_failure);
+  }
+  if code = write_all_filters(conf, o.out, o.format); code != _exit_ok || key == nil {
+    return code;
+  }
+  for i := 0; i < conf.NumDataset(); i++ {
+    path := fmt.Sprintf("%s.%d", o.out, i);
+    if err := sign_filters(conf.Meta(i), conf.Filters(i), key, path + _manifest_suffix); err != nil {
+      log.Printf("[%s] failed to sign %s: %s\n", os.Args[0], path, err.Error());
+      return _exit_output;
+    }
+  }
+  return _exit_ok;
+}
+
+/* blocking and threshold flags shared by compare, link and dedup */
+func compare_flags(fs *flag.FlagSet) (*pprl.CompareOption) {
+  opt := pprl.NewCompareOption(0);
+  fs.Float64Var(&opt.Threshold, "threshold", opt.Threshold, "minimum dice coefficient of a match");
+  fs.IntVar(&opt.Blk, "block_bit", opt.Blk, "#bit sampled for a block key, 0 disables blocking");
+  fs.IntVar(&opt.Iter, "block_iter", opt.Iter, "#blocking iteration");
+  fs.Int64Var(&opt.Seed, "block_seed", opt.Seed, "seed for sampling block bits");
+  fs.IntVar(&opt.Worker, "worker", opt.Worker, "#worker");
+  return opt;
+}
+
+/* one-to-one assignment flags of compare and link */
+func assign_flags(fs *flag.FlagSet, opt *pprl.CompareOption) {
+  fs.StringVar(&opt.Assign, "assign", pprl.AssignNone, "one-to-one assignment: none, greedy or optimal");
+  fs.IntVar(&opt.AssignLimit, "assign_limit", 0, "max #record on either side solved optimally, 0 for default");
+}
+
+/* compare: match two encoded files */
+func cmd_compare(args []string) (int) {
+  var a, b, out string;
+  fs := flag.NewFlagSet("compare", flag.ContinueOnError);
+  fs.StringVar(&a, "a", "", "encoded file of the first dataset (required)");
+  fs.StringVar(&b, "b", "", "encoded file of the second dataset (required)");
+  fs.StringVar(&out, "out", "", "path to match output, stdout if empty");
+  opt := compare_flags(fs);
+  assign_flags(fs, opt);
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  if a == "" || b == "" {
+    log.Printf("[%s] compare: -a and -b are required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  if _, err := pprl.Assign(nil, opt.Assign, opt.AssignLimit); err != nil {
+    log.Printf("[%s] compare: %s\n", os.Args[0], err.Error());
+    return _exit_usage;
+  }
+  meta_a, filter_a, err := read_filters(a);
+  if err != nil {
+    log.Printf("[%s] failed to read %s: %s\n", os.Args[0], a, err.Error());
+    return _exit_data;
+  }
+  meta_b, filter_b, err := read_filters(b);
+  if err != nil {
+    log.Printf("[%s] failed to read %s: %s\n", os.Args[0], b, err.Error());
+    return _exit_data;
+  }
+  if !same_schema(a, meta_a, b, meta_b) {
+    return _exit_data;
+  }
+  opt.Mb = meta_a.Mb;
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  result, err := pprl.CompareContext(ctx, filter_a, filter_b, opt);
+  if err != nil {
+    log.Printf("[%s] failed to compare: %s\n", os.Args[0], err.Error());
+    return exit_code(err, _exit_failure);
+  }
+  if err = write_matches(result.Match, out); err != nil {
+    log.Printf("[%s] failed to write matches: %s\n", os.Args[0], err.Error());
+    return _exit_output;
+  }
+  log.Printf("[%s] %d matches out of %d candidates, %d dropped by assignment\n", os.Args[0], len(result.Match), result.Candidate, result.Dropped);
+  return _exit_ok;
+}
+
+/* link: cluster records of the same entity across encoded files */
+func cmd_link(args []string) (int) {
+  var in, out string;
+  fs := flag.NewFlagSet("link", flag.ContinueOnError);
+  fs.StringVar(&in, "in", "", "encoded files, separated by \",\" (at least 2, required)");
+  fs.StringVar(&out, "out", "", "path to cluster output, stdout if empty");
+  opt := compare_flags(fs);
+  assign_flags(fs, opt);
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  paths := strings.Split(in, ",");
+  if in == "" || len(paths) < 2 {
+    log.Printf("[%s] link: -in needs at least 2 files\n", os.Args[0]);
+    return _exit_usage;
+  }
+  if _, err := pprl.Assign(nil, opt.Assign, opt.AssignLimit); err != nil {
+    log.Printf("[%s] link: %s\n", os.Args[0], err.Error());
+    return _exit_usage;
+  }
+  sets := make([][]*pprl.Filter, len(paths));
+  var first *pprl.Meta;
+  for i, path := range paths {
+    meta, filters, err := read_filters(path);
+    if err != nil {
+      log.Printf("[%s] failed to read %s: %s\n", os.Args[0], path, err.Error());
+      return _exit_data;
+    }
+    if i == 0 {
+      first = meta;
+    } else if !same_schema(paths[0], first, path, meta) {
+      return _exit_data;
+    }
+    opt.Mb = meta.Mb;
+    sets[i] = filters;
+  }
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  result, err := pprl.Link(ctx, sets, opt);
+  if err != nil {
+    log.Printf("[%s] failed to link: %s\n", os.Args[0], err.Error());
+    return exit_code(err, _exit_failure);
+  }
+  w := os.Stdout;
+  if out != "" {
+    if w, err = os.Create(out); err != nil {
+      log.Printf("[%s] failed to create %s: %s\n", os.Args[0], out, err.Error());
+      return _exit_output;
+    }
+    defer w.Close();
+  }
+  if err = pprl.WriteClusters(w, result.Cluster); err != nil {
+    log.Printf("[%s] failed to write clusters: %s\n", os.Args[0], err.Error());
+    return _exit_output;
+  }
+  log.Printf("[%s] %d clusters from %d matches out of %d candidates, %d matches rejected\n", os.Args[0], len(result.Cluster), result.Match, result.Candidate, result.Rejected);
+  return _exit_ok;
+}
+
+/* dedup: cluster duplicates within an encoded file */
+func cmd_dedup(args []string) (int) {
+  var in, out, match string;
+  fs := flag.NewFlagSet("dedup", flag.ContinueOnError);
+  fs.StringVar(&in, "in", "", "encoded file (required)");
+  fs.StringVar(&out, "out", "", "path to cluster of each record, stdout if empty");
+  fs.StringVar(&match, "match", "", "path to duplicate pairs, not written if empty");
+  opt := compare_flags(fs);
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  if in == "" {
+    log.Printf("[%s] dedup: -in is required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  meta, filters, err := read_filters(in);
+  if err != nil {
+    log.Printf("[%s] failed to read %s: %s\n", os.Args[0], in, err.Error());
+    return _exit_data;
+  }
+  opt.Mb = meta.Mb;
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  result, err := pprl.Dedup(ctx, filters, opt);
+  if err != nil {
+    log.Printf("[%s] failed to dedup: %s\n", os.Args[0], err.Error());
+    return exit_code(err, _exit_failure);
+  }
+  w := os.Stdout;
+  if out != "" {
+    if w, err = os.Create(out); err != nil {
+      log.Printf("[%s] failed to create %s: %s\n", os.Args[0], out, err.Error());
+      return _exit_output;
+    }
+    defer w.Close();
+  }
+  if err = pprl.WriteDedup(w, filters, result.Cluster); err != nil {
+    log.Printf("[%s] failed to write clusters: %s\n", os.Args[0], err.Error());
+    return _exit_output;
+  }
+  if match != "" {
+    if err = write_matches(result.Match, match); err != nil {
+      log.Printf("[%s] failed to write duplicate pairs: %s\n", os.Args[0], err.Error());
+      return _exit_output;
+    }
+  }
+  log.Printf("[%s] %d records in %d clusters, %d records have duplicates, %d pairs out of %d candidates\n", os.Args[0], len(filters), result.Clusters, result.Duplicate, len(result.Match), result.Candidate);
+  return _exit_ok;
+}
+
+/* append: encode new records with the schema of an index, match and insert them */
+func cmd_append(args []string) (int) {
+  var o options;
+  var index, against string;
+  var dataset int;
+  fs := new_flags("append", &o);
+  fs.StringVar(&index, "index", "", "index (encoded file) the new records are inserted into (required)");
+  fs.StringVar(&against, "against", "", "index to match new records against, the -index itself if empty");
+  fs.IntVar(&dataset, "dataset", 0, "index of the dataset holding new records in config");
+  fs.StringVar(&o.out, "out", "", "path to matches of new records, stdout if empty");
+  opt := compare_flags(fs);
+  assign_flags(fs, opt);
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  if index == "" {
+    log.Printf("[%s] append: -index is required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  if _, err := pprl.Assign(nil, opt.Assign, opt.AssignLimit); err != nil {
+    log.Printf("[%s] append: %s\n", os.Args[0], err.Error());
+    return _exit_usage;
+  }
+  x, err := read_index(index, opt);
+  if err != nil {
+    log.Printf("[%s] failed to read %s: %s\n", os.Args[0], index, err.Error());
+    return _exit_data;
+  }
+  var other *pprl.Index;
+  if against != "" {
+    if other, err = read_index(against, opt); err != nil {
+      log.Printf("[%s] failed to read %s: %s\n", os.Args[0], against, err.Error());
+      return _exit_data;
+    }
+  }
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  conf, code := init_conf(ctx, &o);
+  if code != _exit_ok {
+    return code;
+  }
+  if dataset < 0 || dataset >= conf.NumDataset() {
+    log.Printf("[%s] append: dataset %d out of range\n", os.Args[0], dataset);
+    return _exit_usage;
+  }
+  if err = conf.PrepareDatasetMeta(ctx, x.Meta); err != nil {
+    log.Printf("[%s] failed to encode new records: %s\n", os.Args[0], err.Error());
+    return exit_code(err, _exit_config);
+  }
+  filters := conf.Filters(dataset);
+  result, err := x.Append(ctx, filters, other);
+  if err != nil {
+    log.Printf("[%s] failed to match new records: %s\n", os.Args[0], err.Error());
+    return exit_code(err, _exit_failure);
+  }
+  /* replace the index only once fully written */
+  tmp := index + ".tmp";
+  fp, err := os.Create(tmp);
+  if err == nil {
+    if err = x.Write(fp); err == nil {
+      err = fp.Close();
+    } else {
+      fp.Close();
+    }
+  }
+  if err == nil {
+    err = os.Rename(tmp, index);
+  }
+  if err != nil {
+    os.Remove(tmp);
+    log.Printf("[%s] failed to write %s: %s\n", os.Args[0], index, err.Error());
+    return _exit_output;
+  }
+  if err = write_matches(result.Match, o.out); err != nil {
+    log.Printf("[%s] failed to write matches: %s\n", os.Args[0], err.Error());
+    return _exit_output;
+  }
+  log.Printf("[%s] %d new records indexed (%d in total), %d matches out of %d candidates\n", os.Args[0], len(filters), x.Meta.Count, len(result.Match), result.Candidate);
+  return _exit_ok;
+}
+
+/* evaluate: linkage quality against a ground truth field */
+func cmd_evaluate(args []string) (int) {
+  var o options;
+  var truth, da, db int;
+  var curve string;
+  var as_json bool;
+  fs := new_flags("evaluate", &o);
+  fs.StringVar(&o.match, "match", "", "match file of datasets -a and -b, datasets are encoded and compared if empty");
+  fs.IntVar(&truth, "truth", 0, "index of the field holding the true entity identifier");
+  fs.IntVar(&da, "a", 0, "index of the first dataset in config");
+  fs.IntVar(&db, "b", 1, "index of the second dataset in config");
+  fs.StringVar(&curve, "curve", "", "thresholds of the precision-recall curve, separated by \",\"; with -match, only matches in the file are counted");
+  fs.BoolVar(&as_json, "json", false, "print evaluation as JSON");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  var thresholds []float64;
+  if curve != "" {
+    for _, s := range strings.Split(curve, ",") {
+      t, err := strconv.ParseFloat(strings.TrimSpace(s), 64);
+      if err != nil {
+        log.Printf("[%s] invalid threshold %s\n", os.Args[0], s);
+        return _exit_usage;
+      }
+      thresholds = append(thresholds, t);
+    }
+  }
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  conf, code := init_conf(ctx, &o);
+  if code != _exit_ok {
+    return code;
+  }
+  var result *pprl.Evaluation;
+  if o.match != "" {
+    /* matches only, blocking is unknown */
+    fp, err := os.Open(o.match);
+    if err != nil {
+      log.Printf("[%s] failed to open %s: %s\n", os.Args[0], o.match, err.Error());
+      return _exit_data;
+    }
+    matches, err := pprl.ReadMatches(fp);
+    fp.Close();
+    if err != nil {
+      log.Printf("[%s] failed to read %s: %s\n", os.Args[0], o.match, err.Error());
+      return _exit_data;
+    }
+    truth_a, err := conf.Truth(da, truth);
+    if err != nil {
+      log.Printf("[%s] invalid ground truth: %s\n", os.Args[0], err.Error());
+      return _exit_usage;
+    }
+    truth_b, err := conf.Truth(db, truth);
+    if err != nil {
+      log.Printf("[%s] invalid ground truth: %s\n", os.Args[0], err.Error());
+      return _exit_usage;
+    }
+    result = pprl.Evaluate(matches, truth_a, truth_b);
+    if thresholds != nil {
+      (*result).Curve = pprl.EvaluateCurve(matches, truth_a, truth_b, thresholds);
+    }
+  } else {
+    if err := conf.PrepareDatasetContext(ctx); err != nil {
+      log.Printf("[%s] failed to prepare dataset: %s\n", os.Args[0], err.Error());
+      return exit_code(err, _exit_failure);
+    }
+    var err error;
+    if result, err = conf.Evaluate(ctx, da, db, truth, thresholds); err != nil {
+      log.Printf("[%s] failed to evaluate: %s\n", os.Args[0], err.Error());
+      return exit_code(err, _exit_usage);
+    }
+  }
+  if as_json {
+    encoder := json.NewEncoder(os.Stdout);
+    encoder.SetIndent("", "  ");
+    if err := encoder.Encode(result); err != nil {
+      return _exit_output;
+    }
+  } else {
+    result.Print(os.Stdout);
+  }
+  return _exit_ok;
+}
+
+/* serve: linkage unit receiving encoded records over HTTP */
+func cmd_serve(args []string) (int) {
+  var addr string;
+  var opt pprl.ServerOption;
+  fs := flag.NewFlagSet("serve", flag.ContinueOnError);
+  fs.StringVar(&addr, "addr", ":8080", "listen address");
+  fs.StringVar(&opt.Dir, "dir", "", "directory of uploads, a temporary one removed on exit if empty");
+  fs.StringVar(&opt.AdminToken, "admin_token", os.Getenv("PPRL_ADMIN_TOKEN"), "token required to create projects, $PPRL_ADMIN_TOKEN by default");
+  fs.Int64Var(&opt.MaxChunk, "max_chunk", 0, "max #byte of an upload request, 0 for default");
+  fs.IntVar(&opt.Worker, "worker", 0, "#worker for comparison, 0 for all cores");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  server, err := pprl.NewServer(opt);
+  if err != nil {
+    log.Printf("[%s] failed to start linkage unit: %s\n", os.Args[0], err.Error());
+    return _exit_failure;
+  }
+  defer server.Close();
+  hs := &http.Server {
+    Addr: addr,
+    Handler: server,
+  };
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  go func() {
+    <-ctx.Done();
+    hs.Shutdown(context.Background());
+  }();
+  if opt.AdminToken == "" {
+    log.Printf("[%s] no admin token, anyone may create projects\n", os.Args[0]);
+  }
+  log.Printf("[%s] linkage unit listening on %s\n", os.Args[0], addr);
+  if err = hs.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+    log.Printf("[%s] linkage unit stopped: %s\n", os.Args[0], err.Error());
+    return _exit_failure;
+  }
+  return _exit_ok;
+}
+
+/* client: encode a dataset, upload it to a linkage unit and fetch the result */
+func cmd_client(args []string) (int) {
+  var o options;
+  var server, token, project, party, create, schema, in, spool, assign string;
+  var dataset, retry int;
+  var chunk int64;
+  var threshold float64;
+  var match bool;
+  var wait time.Duration;
+  fs := new_flags("client", &o);
+  fs.StringVar(&server, "server", "", "URL of the linkage unit (required)");
+  fs.StringVar(&token, "token", os.Getenv("PPRL_TOKEN"), "party token, or admin token with -create; $PPRL_TOKEN by default");
+  fs.StringVar(&project, "project", "", "project id");
+  fs.StringVar(&party, "party", "", "party name");
+  fs.StringVar(&create, "create", "", "create a project of parties separated by \",\", print its tokens and exit");
+  fs.Float64Var(&threshold, "threshold", pprl.NewCompareOption(0).Threshold, "minimum dice coefficient of a match, with -create");
+  fs.StringVar(&assign, "assign", pprl.AssignNone, "one-to-one assignment: none, greedy or optimal, with -create");
+  fs.IntVar(&dataset, "dataset", 0, "index of the dataset to encode in config");
+  fs.StringVar(&schema, "schema", "", "encoded file or its metadata JSON holding the shared schema, planned locally if empty");
+  fs.StringVar(&in, "in", "", "encoded file to upload instead of encoding from config");
+  fs.StringVar(&spool, "spool", "", "path of the encoded file before upload, in the temporary directory if empty");
+  fs.Int64Var(&chunk, "chunk", 0, "#byte per upload request, 0 for default");
+  fs.IntVar(&retry, "retry", -1, "#retry of a failed request, -1 for default");
+  fs.BoolVar(&match, "match", false, "start linkage after upload, once every party is done");
+  fs.DurationVar(&wait, "wait", 0, "poll interval for the result, the result is not fetched if 0");
+  fs.StringVar(&o.out, "out", "", "path to the result, stdout if empty");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  if server == "" {
+    log.Printf("[%s] client: -server is required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  c := pprl.NewClient(strings.TrimRight(server, "/"), token);
+  if chunk > 0 {
+    c.Chunk = chunk;
+  }
+  if retry >= 0 {
+    c.Retry = retry;
+  }
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  if create != "" {
+    resp, err := c.CreateProject(ctx, &pprl.ProjectRequest {
+      Parties: strings.Split(create, ","),
+      Threshold: &threshold,
+      Assign: assign,
+    });
+    if err != nil {
+      log.Printf("[%s] failed to create project: %s\n", os.Args[0], err.Error());
+      return exit_code(err, _exit_failure);
+    }
+    encoder := json.NewEncoder(os.Stdout);
+    encoder.SetIndent("", "  ");
+    encoder.Encode(resp);
+    return _exit_ok;
+  }
+  if project == "" || party == "" {
+    log.Printf("[%s] client: -project and -party are required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  if in == "" {
+    if spool == "" {
+      spool = filepath.Join(os.TempDir(), "pprl-" + project + "-" + party + ".bin");
+    }
+    if code := encode_dataset(ctx, &o, dataset, schema, spool); code != _exit_ok {
+      return code;
+    }
+    in = spool;
+  }
+  fp, err := os.Open(in);
+  if err != nil {
+    log.Printf("[%s] failed to open %s: %s\n", os.Args[0], in, err.Error());
+    return _exit_data;
+  }
+  defer fp.Close();
+  info, err := fp.Stat();
+  if err != nil {
+    log.Printf("[%s] failed to open %s: %s\n", os.Args[0], in, err.Error());
+    return _exit_data;
+  }
+  if o.progress {
+    c.Progress = func(done, total int64) {
+      log.Printf("[%s] uploaded %d/%d bytes\n", os.Args[0], done, total);
+    };
+  }
+  ps, err := c.Upload(ctx, project, party, fp, info.Size());
+  if err != nil {
+    log.Printf("[%s] failed to upload %s: %s\n", os.Args[0], in, err.Error());
+    return exit_code(err, _exit_failure);
+  }
+  log.Printf("[%s] %d records of %s uploaded, sha256 %s\n", os.Args[0], ps.Count, party, ps.Sha256);
+  if match {
+    for {
+      _, err = c.Match(ctx, project);
+      var he *pprl.HTTPError;
+      /* other parties may still be uploading */
+      if err != nil && errors.As(err, &he) && he.Code == http.StatusConflict && wait > 0 {
+        log.Printf("[%s] %s, retry in %s\n", os.Args[0], he.Message, wait);
+        select {
+        case <-ctx.Done():
+          return _exit_cancel;
+        case <-time.After(wait):
+        }
+        continue;
+      }
+      break;
+    }
+    if err != nil {
+      log.Printf("[%s] failed to start linkage: %s\n", os.Args[0], err.Error());
+      return exit_code(err, _exit_failure);
+    }
+  }
+  if wait <= 0 {
+    return _exit_ok;
+  }
+  st, err := c.Wait(ctx, project, wait);
+  if err != nil {
+    log.Printf("[%s] linkage did not finish: %s\n", os.Args[0], err.Error());
+    return exit_code(err, _exit_failure);
+  }
+  w := os.Stdout;
+  if o.out != "" {
+    if w, err = os.Create(o.out); err != nil {
+      log.Printf("[%s] failed to create %s: %s\n", os.Args[0], o.out, err.Error());
+      return _exit_output;
+    }
+    defer w.Close();
+  }
+  if err = c.Results(ctx, project, party, w); err != nil {
+    log.Printf("[%s] failed to download result: %s\n", os.Args[0], err.Error());
+    return exit_code(err, _exit_output);
+  }
+  log.Printf("[%s] result of %d clusters fetched\n", os.Args[0], st.Clusters);
+  return _exit_ok;
+}
+
+/* stream: exchange encoded records as a checked stream, over TCP or to a linkage unit */
+func cmd_stream(args []string) (int) {
+  var in, out, listen, connect, server, token, project, party string;
+  var chunk int;
+  fs := flag.NewFlagSet("stream", flag.ContinueOnError);
+  fs.StringVar(&in, "in", "", "encoded file to send");
+  fs.StringVar(&out, "out", "", "path of the received encoded file, with -listen");
+  fs.StringVar(&listen, "listen", "", "receive one stream on this TCP address");
+  fs.StringVar(&connect, "connect", "", "send to a receiver at this TCP address");
+  fs.StringVar(&server, "server", "", "send to a linkage unit at this URL");
+  fs.StringVar(&token, "token", os.Getenv("PPRL_TOKEN"), "party token, with -server; $PPRL_TOKEN by default");
+  fs.StringVar(&project, "project", "", "project id, with -server");
+  fs.StringVar(&party, "party", "", "party name, with -server");
+  fs.IntVar(&chunk, "chunk", 0, "#byte of records per chunk, 0 for default");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  if listen != "" {
+    if out == "" {
+      log.Printf("[%s] stream: -out is required with -listen\n", os.Args[0]);
+      return _exit_usage;
+    }
+    return receive_stream(listen, out);
+  }
+  if in == "" || (connect == "") == (server == "") {
+    log.Printf("[%s] stream: -in and one of -connect, -server or -listen are required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  meta, src, closer, err := open_source(in);
+  if err != nil {
+    log.Printf("[%s] failed to read %s: %s\n", os.Args[0], in, err.Error());
+    return _exit_data;
+  }
+  defer closer.Close();
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  if server != "" {
+    if project == "" || party == "" {
+      log.Printf("[%s] stream: -project and -party are required with -server\n", os.Args[0]);
+      return _exit_usage;
+    }
+    c := pprl.NewClient(strings.TrimRight(server, "/"), token);
+    (*c).Chunk = int64(chunk);
+    ps, err := c.Stream(ctx, project, party, meta, src);
+    if err != nil {
+      log.Printf("[%s] failed to stream %s: %s\n", os.Args[0], in, err.Error());
+      return exit_code(err, _exit_failure);
+    }
+    log.Printf("[%s] %d records of %s streamed, sha256 %s\n", os.Args[0], ps.Count, party, ps.Sha256);
+    return _exit_ok;
+  }
+  var dialer net.Dialer;
+  conn, err := dialer.DialContext(ctx, "tcp", connect);
+  if err != nil {
+    log.Printf("[%s] failed to connect %s: %s\n", os.Args[0], connect, err.Error());
+    return _exit_failure;
+  }
+  defer conn.Close();
+  manifest, err := pprl.SendStream(conn, meta, src, chunk);
+  if err == nil {
+    err = pprl.ReadStreamAck(conn, manifest);
+  }
+  if err != nil {
+    log.Printf("[%s] failed to stream %s: %s\n", os.Args[0], in, err.Error());
+    return exit_code(err, _exit_failure);
+  }
+  log.Printf("[%s] %d records in %d chunks streamed, sha256 %s\n", os.Args[0], manifest.Count, manifest.Chunk, manifest.Sha256);
+  return _exit_ok;
+}
+
+/* accept one stream on addr and write it to out once verified */
+func receive_stream(addr, out string) (int) {
+  ln, err := net.Listen("tcp", addr);
+  if err != nil {
+    log.Printf("[%s] failed to listen on %s: %s\n", os.Args[0], addr, err.Error());
+    return _exit_failure;
+  }
+  defer ln.Close();
+  log.Printf("[%s] waiting for a stream on %s\n", os.Args[0], ln.Addr().String());
+  conn, err := ln.Accept();
+  if err != nil {
+    log.Printf("[%s] failed to accept: %s\n", os.Args[0], err.Error());
+    return _exit_failure;
+  }
+  defer conn.Close();
+  /* written aside and renamed, so out never holds a partial stream */
+  tmp := out + ".tmp";
+  fp, err := os.Create(tmp);
+  if err != nil {
+    log.Printf("[%s] failed to create %s: %s\n", os.Args[0], tmp, err.Error());
+    return _exit_output;
+  }
+  _, manifest, err := pprl.ReceiveStream(conn, fp);
+  if cerr := fp.Close(); err == nil {
+    err = cerr;
+  }
+  if err == nil {
+    err = os.Rename(tmp, out);
+  }
+  pprl.WriteStreamAck(conn, manifest, err);
+  if err != nil {
+    os.Remove(tmp);
+    log.Printf("[%s] failed to receive from %s: %s\n", os.Args[0], conn.RemoteAddr().String(), err.Error());
+    return exit_code(err, _exit_data);
+  }
+  log.Printf("[%s] %d records in %d chunks received, sha256 %s\n", os.Args[0], manifest.Count, manifest.Chunk, manifest.Sha256);
+  return _exit_ok;
+}
+
+/* encode a dataset of config as a binary container at path, with a shared schema if given */
+func encode_dataset(ctx context.Context, o *options, dataset int, schema, path string) (int) {
+  conf, code := init_conf(ctx, o);
+  if code != _exit_ok {
+    return code;
+  }
+  if dataset < 0 || dataset >= conf.NumDataset() {
+    log.Printf("[%s] dataset %d out of range\n", os.Args[0], dataset);
+    return _exit_usage;
+  }
+  var err error;
+  if schema != "" {
+    var meta *pprl.Meta;
+    meta, err = read_schema(schema);
+    if err != nil {
+      log.Printf("[%s] failed to read schema %s: %s\n", os.Args[0], schema, err.Error());
+      return _exit_data;
+    }
+    err = conf.PrepareDatasetMeta(ctx, meta);
+  } else {
+    log.Printf("[%s] no shared schema, encoding parameters are planned locally\n", os.Args[0]);
+    err = conf.PrepareDatasetContext(ctx);
+  }
+  if err != nil {
+    log.Printf("[%s] failed to prepare dataset: %s\n", os.Args[0], err.Error());
+    return exit_code(err, _exit_config);
+  }
+  if err = write_filters(conf, dataset, path, _format_binary); err != nil {
+    log.Printf("[%s] failed to write %s: %s\n", os.Args[0], path, err.Error());
+    return _exit_output;
+  }
+  return _exit_ok;
+}
+
+/* schema from metadata JSON, or from the metadata of an encoded file */
+func read_schema(path string) (*pprl.Meta, error) {
+  data, err := os.ReadFile(path);
+  if err != nil {
+    return nil, err;
+  }
+  if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+    meta := &pprl.Meta{};
+    if err = json.Unmarshal(trimmed, meta); err != nil {
+      return nil, err;
+    }
+    return meta, nil;
+  }
+  meta, _, err := read_filters(path);
+  return meta, err;
+}
+
+/* key: list the keys of a key file, or add a new one */
+func cmd_key(args []string) (int) {
+  var file, add string;
+  fs := flag.NewFlagSet("key", flag.ContinueOnError);
+  fs.StringVar(&file, "file", "", "key file (required)");
+  fs.StringVar(&add, "new", "", "add a key of this id, creating the file if missing; it becomes the newest key");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  if file == "" {
+    log.Printf("[%s] key: -file is required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  kf, err := pprl.ReadKeyFile(file);
+  if errors.Is(err, os.ErrNotExist) && add != "" {
+    kf, err = &pprl.KeyFile{}, nil;
+  }
+  if err != nil {
+    log.Printf("[%s] failed to read key file %s: %s\n", os.Args[0], file, err.Error());
+    return _exit_config;
+  }
+  if add != "" {
+    if _, err = kf.Add(add, time.Now()); err != nil {
+      log.Printf("[%s] failed to add key %s: %s\n", os.Args[0], add, err.Error());
+      return _exit_usage;
+    }
+    if err = kf.Write(file); err != nil {
+      log.Printf("[%s] failed to write key file %s: %s\n", os.Args[0], file, err.Error());
+      return _exit_output;
+    }
+    log.Printf("[%s] key %s added to %s\n", os.Args[0], add, file);
+  }
+  /* secrets are never printed */
+  newest, _ := kf.Get("");
+  for _, k := range kf.Key {
+    mark := "";
+    if k == newest {
+      mark = " (newest)";
+    }
+    fmt.Printf("%s %s %s%s\n", k.Id, k.Algorithm, k.Created, mark);
+  }
+  return _exit_ok;
+}
+
+/* rekey: encode datasets again under another key, keeping the schema of a previous encoding */
+func cmd_rekey(args []string) (int) {
+  var o options;
+  var from, key string;
+  fs := new_flags("rekey", &o);
+  fs.StringVar(&from, "from", "", "file encoded under the old key, whose schema is kept (required)");
+  fs.StringVar(&key, "key_id", "", "key of key_file to encode with, the newest if empty");
+  fs.StringVar(&o.out, "out", "", "prefix of encoded output, dataset i is written to <prefix>.<i> (required)");
+  fs.StringVar(&o.format, "format", _format_text, "encoded output format: text or binary");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  if from == "" || o.out == "" {
+    log.Printf("[%s] rekey: -from and -out are required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  if o.format != _format_text && o.format != _format_binary {
+    log.Printf("[%s] rekey: unknown format %s\n", os.Args[0], o.format);
+    return _exit_usage;
+  }
+  meta, err := read_schema(from);
+  if err != nil {
+    log.Printf("[%s] failed to read %s: %s\n", os.Args[0], from, err.Error());
+    return _exit_data;
+  }
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  conf, code := init_conf(ctx, &o);
+  if code != _exit_ok {
+    return code;
+  }
+  if err = conf.UseKey(key); err != nil {
+    log.Printf("[%s] failed to select key %q: %s\n", os.Args[0], key, err.Error());
+    return _exit_config;
+  }
+  if meta.KeyId == conf.ActiveKey() {
+    log.Printf("[%s] %s is already encoded under key %s\n", os.Args[0], from, meta.KeyId);
+    return _exit_usage;
+  }
+  log.Printf("[%s] re-encoding from key %q to key %q\n", os.Args[0], meta.KeyId, conf.ActiveKey());
+  schema := *meta;
+  schema.KeyId = conf.ActiveKey();
+  if err = conf.PrepareDatasetMeta(ctx, &schema); err != nil {
+    log.Printf("[%s] failed to prepare dataset: %s\n", os.Args[0], err.Error());
+    return exit_code(err, _exit_config);
+  }
+  return write_all_filters(conf, o.out, o.format);
+}
+
+/* sign: signed manifest of an encoded file */
+func cmd_sign(args []string) (int) {
+  var in, key, out, keygen string;
+  fs := flag.NewFlagSet("sign", flag.ContinueOnError);
+  fs.StringVar(&in, "in", "", "encoded file to sign");
+  fs.StringVar(&key, "key", "", "signing key (PEM)");
+  fs.StringVar(&out, "out", "", "path of the manifest, <in>" + _manifest_suffix + " if empty");
+  fs.StringVar(&keygen, "keygen", "", "generate a signing key to <prefix>.key and its public key to <prefix>.pub, then exit");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  if keygen != "" {
+    return generate_signing_key(keygen);
+  }
+  if in == "" || key == "" {
+    log.Printf("[%s] sign: -in and -key are required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  if out == "" {
+    out = in + _manifest_suffix;
+  }
+  private, err := read_signing_key(key);
+  if err != nil {
+    log.Printf("[%s] failed to read signing key %s: %s\n", os.Args[0], key, err.Error());
+    return _exit_usage;
+  }
+  meta, filters, err := read_filters(in);
+  if err != nil {
+    log.Printf("[%s] failed to read %s: %s\n", os.Args[0], in, err.Error());
+    return _exit_data;
+  }
+  if err = sign_filters(meta, filters, private, out); err != nil {
+    log.Printf("[%s] failed to write %s: %s\n", os.Args[0], out, err.Error());
+    return _exit_output;
+  }
+  return _exit_ok;
+}
+
+/* verify: check an encoded file against its signed manifest */
+func cmd_verify(args []string) (int) {
+  var in, manifest, public string;
+  fs := flag.NewFlagSet("verify", flag.ContinueOnError);
+  fs.StringVar(&in, "in", "", "encoded file to verify (required)");
+  fs.StringVar(&manifest, "manifest", "", "signed manifest, <in>" + _manifest_suffix + " if empty");
+  fs.StringVar(&public, "pub", "", "public key of the expected signer (PEM); without it any valid signature is accepted");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  if in == "" {
+    log.Printf("[%s] verify: -in is required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  if manifest == "" {
+    manifest = in + _manifest_suffix;
+  }
+  var trusted ed25519.PublicKey;
+  if public != "" {
+    data, err := os.ReadFile(public);
+    if err == nil {
+      trusted, err = pprl.ParsePublicKey(data);
+    }
+    if err != nil {
+      log.Printf("[%s] failed to read public key %s: %s\n", os.Args[0], public, err.Error());
+      return _exit_usage;
+    }
+  }
+  fp, err := os.Open(manifest);
+  if err != nil {
+    log.Printf("[%s] failed to open %s: %s\n", os.Args[0], manifest, err.Error());
+    return _exit_data;
+  }
+  m, err := pprl.ReadManifest(fp);
+  fp.Close();
+  if err != nil {
+    log.Printf("[%s] failed to read manifest %s: %s\n", os.Args[0], manifest, err.Error());
+    return _exit_data;
+  }
+  meta, filters, err := read_filters(in);
+  if err != nil {
+    log.Printf("[%s] failed to read %s: %s\n", os.Args[0], in, err.Error());
+    return _exit_data;
+  }
+  if err = m.Verify(meta, filters, trusted); err != nil {
+    log.Printf("[%s] %s does not verify: %s\n", os.Args[0], in, err.Error());
+    return _exit_data;
+  }
+  if trusted == nil {
+    log.Printf("[%s] signer is not checked, pass -pub to pin it\n", os.Args[0]);
+  }
+  fmt.Printf("ok: %s\n", in);
+  fmt.Printf("count: %d\n", m.Count);
+  fmt.Printf("schema: %s\n", m.Schema);
+  fmt.Printf("hardening: %s\n", m.Hardening);
+  if m.KeyId != "" {
+    fmt.Printf("key_id: %s\n", m.KeyId);
+  }
+  fmt.Printf("created: %s\n", m.Created);
+  fmt.Printf("signer: %s\n", m.PublicKey);
+  return _exit_ok;
+}
+
+/* write a signed manifest of filters to path */
+func sign_filters(meta *pprl.Meta, filters []*pprl.Filter, key ed25519.PrivateKey, path string) (error) {
+  m := pprl.NewEncodingManifest(meta, filters, time.Now());
+  if err := m.Sign(key); err != nil {
+    return err;
+  }
+  fp, err := os.Create(path);
+  if err != nil {
+    return err;
+  }
+  if err = pprl.WriteManifest(fp, m); err != nil {
+    fp.Close();
+    return err;
+  }
+  if err = fp.Close(); err != nil {
+    return err;
+  }
+  log.Printf("[%s] signed manifest written to %s\n", os.Args[0], path);
+  return nil;
+}
+
+/* signing key from a PEM file */
+func read_signing_key(path string) (ed25519.PrivateKey, error) {
+  data, err := os.ReadFile(path);
+  if err != nil {
+    return nil, err;
+  }
+  return pprl.ParseSigningKey(data);
+}
+
+/* write a new signing key to <prefix>.key, readable by owner only, and its public key to <prefix>.pub */
+func generate_signing_key(prefix string) (int) {
+  key, err := pprl.GenerateSigningKey();
+  if err != nil {
+    log.Printf("[%s] failed to generate signing key: %s\n", os.Args[0], err.Error());
+    return _exit_failure;
+  }
+  var public bytes.Buffer;
+  pprl.WritePublicKey(&public, key.Public().(ed25519.PublicKey));
+  var private bytes.Buffer;
+  if err = pprl.WriteSigningKey(&private, key); err != nil {
+    log.Printf("[%s] failed to generate signing key: %s\n", os.Args[0], err.Error());
+    return _exit_failure;
+  }
+  /* existing keys are never overwritten */
+  if err = write_new_file(prefix + ".key", private.Bytes(), 0600); err != nil {
+    log.Printf("[%s] failed to write %s.key: %s\n", os.Args[0], prefix, err.Error());
+    return _exit_output;
+  }
+  if err = write_new_file(prefix + ".pub", public.Bytes(), 0644); err != nil {
+    log.Printf("[%s] failed to write %s.pub: %s\n", os.Args[0], prefix, err.Error());
+    return _exit_output;
+  }
+  log.Printf("[%s] signing key written to %s.key, public key to %s.pub\n", os.Args[0], prefix, prefix);
+  return _exit_ok;
+}
+
+/* write data to a file that must not exist yet */
+func write_new_file(path string, data []byte, mode os.FileMode) (error) {
+  fp, err := os.OpenFile(path, os.O_WRONLY | os.O_CREATE | os.O_EXCL, mode);
+  if err != nil {
+    return err;
+  }
+  if _, err = fp.Write(data); err != nil {
+    fp.Close();
+    return err;
+  }
+  return fp.Close();
+}
+
+/* inspect: metadata and bit statistics of an encoded file */
+func cmd_inspect(args []string) (int) {
+  var in string;
+  fs := flag.NewFlagSet("inspect", flag.ContinueOnError);
+  fs.StringVar(&in, "in", "", "encoded file (required)");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  if in == "" {
+    log.Printf("[%s] inspect: -in is required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  meta, filters, err := read_filters(in);
+  if err != nil {
+    log.Printf("[%s] failed to read %s: %s\n", os.Args[0], in, err.Error());
+    return _exit_data;
+  }
+  fmt.Printf("file: %s\nbloom_bit: %d\nngram: %d\ncount: %d\n", in, meta.Mb, meta.Ngram, meta.Count);
+  schema := pprl.SchemaHash(meta);
+  fmt.Printf("schema: %x\n", schema[:]);
+  fmt.Printf("hardening: %s\n", meta.AppliedHardening());
+  if meta.KeyId != "" {
+    fmt.Printf("key_id: %s\n", meta.KeyId);
+  }
+  fmt.Printf("hash_seed: %s\n", meta.HashSeed());
+  for i, name := range meta.Field {
+    if i < len(meta.K) {
+      fmt.Printf("field %d (%s): k=%d\n", i, name, meta.K[i]);
+    }
+  }
+  on := 0;
+  for _, f := range filters {
+    for _, c := range f.Bits {
+      on += bits.OnesCount8(c);
+    }
+  }
+  if len(filters) > 0 && meta.Mb > 0 {
+    fmt.Printf("average on bits: %f, fill: %f\n", float64(on) / float64(len(filters)), float64(on) / float64(len(filters) * meta.Mb));
+  }
+  return _exit_ok;
+}
+
+/* read an encoded file, text or binary */
+func read_filters(path string) (*pprl.Meta, []*pprl.Filter, error) {
+  fp, err := os.Open(path);
+  if err != nil {
+    return nil, nil, err;
+  }
+  defer fp.Close();
+  r := bufio.NewReader(fp);
+  if pprl.IsBinary(r) {
+    /* filters point into the mapping, which is kept until the process exits */
+    b, err := pprl.OpenBinary(path);
+    if err != nil {
+      return nil, nil, err;
+    }
+    return b.Meta, b.Filters(), nil;
+  }
+  return pprl.ReadFilters(r);
+}
+
+/* whether two encoded files are comparable, the fields that differ are logged otherwise */
+func same_schema(a string, meta_a *pprl.Meta, b string, meta_b *pprl.Meta) (bool) {
+  if pprl.SchemaHash(meta_a) == pprl.SchemaHash(meta_b) {
+    return true;
+  }
+  log.Printf("[%s] %s and %s were encoded under different schemas, differing in %s\n", os.Args[0], a, b, strings.Join(pprl.SchemaDiff(meta_a, meta_b), ", "));
+  return false;
+}
+
+/* records of an encoded file, text or binary, read one at a time; close when done */
+func open_source(path string) (*pprl.Meta, pprl.FilterSource, io.Closer, error) {
+  fp, err := os.Open(path);
+  if err != nil {
+    return nil, nil, nil, err;
+  }
+  r := bufio.NewReader(fp);
+  if pprl.IsBinary(r) {
+    fp.Close();
+    b, err := pprl.OpenBinary(path);
+    if err != nil {
+      return nil, nil, nil, err;
+    }
+    return b.Meta, b.Source(), b, nil;
+  }
+  fr, err := pprl.NewFilterReader(r);
+  if err != nil {
+    fp.Close();
+    return nil, nil, nil, err;
+  }
+  return fr.Meta, fr, fp, nil;
+}
+
+/* generate: synthetic datasets with ground truth in rec_id */
+func cmd_generate(args []string) (int) {
+  var dir, conf_out string;
+  names := [2]string{"a.csv", "b.csv"};
+  def := pprl.NewGenerateOption(1000, 1000);
+  opt := *def;
+  fs := flag.NewFlagSet("generate", flag.ContinueOnError);
+  fs.StringVar(&dir, "dir", "", "directory of generated datasets (required)");
+  fs.StringVar(&names[0], "name_a", names[0], "file name of the first dataset");
+  fs.StringVar(&names[1], "name_b", names[1], "file name of the second dataset");
+  fs.StringVar(&conf_out, "conf_out", "", "path to write a config of the generated datasets");
+  fs.IntVar(&opt.SizeA, "size_a", def.SizeA, "#record of the first dataset");
+  fs.IntVar(&opt.SizeB, "size_b", def.SizeB, "#record of the second dataset");
+  fs.Float64Var(&opt.Overlap, "overlap", def.Overlap, "ratio of records in the second dataset whose entity is in the first");
+  fs.Float64Var(&opt.Duplicate, "duplicate", def.Duplicate, "ratio of records duplicating an entity within the same dataset");
+  fs.Float64Var(&opt.Corrupt, "corrupt", def.Corrupt, "probability a copied record is corrupted");
+  fs.IntVar(&opt.MaxCorrupt, "max_corrupt", def.MaxCorrupt, "max #corruption of a corrupted record");
+  fs.Int64Var(&opt.Seed, "seed", def.Seed, "seed of the random source");
+  fs.Float64Var(&opt.Typo, "typo", def.Typo, "weight of keyboard typos");
+  fs.Float64Var(&opt.OCR, "ocr", def.OCR, "weight of OCR errors");
+  fs.Float64Var(&opt.Phonetic, "phonetic", def.Phonetic, "weight of phonetic substitutions");
+  fs.Float64Var(&opt.Missing, "missing", def.Missing, "weight of missing values");
+  fs.Float64Var(&opt.Swap, "swap", def.Swap, "weight of swapped fields");
+  if code, ok := parse_flags(fs, args); !ok {
+    return code;
+  }
+  if dir == "" {
+    log.Printf("[%s] generate: -dir is required\n", os.Args[0]);
+    return _exit_usage;
+  }
+  var fp [2]*os.File;
+  for i, name := range names {
+    var err error;
+    if fp[i], err = os.Create(dir + "/" + name); err != nil {
+      log.Printf("[%s] failed to create %s/%s: %s\n", os.Args[0], dir, name, err.Error());
+      return _exit_output;
+    }
+    defer fp[i].Close();
+  }
+  if err := pprl.Generate(&opt, fp[0], fp[1]); err != nil {
+    log.Printf("[%s] failed to generate datasets: %s\n", os.Args[0], err.Error());
+    if _, ok := err.(pprl.Error); ok {
+      return _exit_usage;
+    }
+    return _exit_output;
+  }
+  if conf_out == "" {
+    return _exit_ok;
+  }
+  /* rec_id and rec_key are not encoded, rec_key identifies records */
+  conf := map[string]interface{} {
+    "prefix": dir,
+    "dataset": names[0] + "," + names[1],
+    "num_field": len(pprl.GenerateField),
+    "ignore": fmt.Sprintf("0,%d", len(pprl.GenerateField) - 1),
+    "size": fmt.Sprintf("%d,%d", opt.SizeA, opt.SizeB),
+    "id_field": len(pprl.GenerateField) - 1,
+  };
+  buf, _ := json.MarshalIndent(conf, "", "  ");
+  if err := os.WriteFile(conf_out, append(buf, '\n'), 0644); err != nil {
+    log.Printf("[%s] failed to write %s: %s\n", os.Args[0], conf_out, err.Error());
+    return _exit_output;
+  }
+  return _exit_ok;
+}
+
+/* read an index */
+func read_index(path string, opt *pprl.CompareOption) (*pprl.Index, error) {
+  fp, err := os.Open(path);
+  if err != nil {
+    return nil, err;
+  }
+  defer fp.Close();
+  return pprl.ReadIndex(fp, opt);
+}
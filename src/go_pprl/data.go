@@ -1,16 +1,97 @@
 package main;
 
 import "flag";
+import "strings";
+
+import "pprl";
+
+/* exit codes */
+const _exit_ok = 0;
+const _exit_failure = 1;          // a stage failed
+const _exit_usage = 2;            // unknown subcommand or invalid flags
+const _exit_config = 3;           // invalid config
+const _exit_data = 4;             // unusable dataset or input file
+const _exit_output = 5;           // failed to write output
+const _exit_cancel = 130;         // interrupted
+
+/* encoded output formats */
+const _format_text = "text";      // metadata line and base64 lines
+const _format_binary = "binary";  // binary container, memory mapped when read
+
+/* signed manifest of an encoded file is written next to it with this suffix */
+const _manifest_suffix = ".manifest";
 
 type options struct {
   debug bool;
+  progress bool;
   conf string;
+  set set_flag;                   // -set key=value overrides of config keys
+  out string;
+  match string;
+  format string;
+}
+
+/* repeatable flag collecting key=value */
+type set_flag []string;
+
+/* subcommand */
+type command struct {
+  name string;                    // name on command line
+  usage string;                   // one line description
+  run func(args []string) (int);  // returns exit code
 }
 
+/* options of the default (no subcommand) pipeline */
 var opts options;
 
+/* subcommands, in the order of a typical batch job */
+var commands = []*command {
+  &command{"generate", "generate two overlapping synthetic datasets", cmd_generate},
+  &command{"validate-config", "check every config field and report all problems", cmd_validate},
+  &command{"config", "print the effective config after includes, environment and -set overrides", cmd_config},
+  &command{"profile", "print field statistics of datasets", cmd_profile},
+  &command{"plan", "print encoding parameters of each field", cmd_plan},
+  &command{"encode", "encode datasets into bloom filters", cmd_encode},
+  &command{"compare", "compare two encoded files", cmd_compare},
+  &command{"append", "encode new records with the schema of an index and match them", cmd_append},
+  &command{"link", "cluster records of the same entity across encoded files", cmd_link},
+  &command{"dedup", "cluster duplicates within an encoded file", cmd_dedup},
+  &command{"evaluate", "evaluate matches against a ground truth field", cmd_evaluate},
+  &command{"serve", "run a linkage unit receiving encoded records over HTTP", cmd_serve},
+  &command{"client", "encode a dataset, upload it to a linkage unit and fetch the result", cmd_client},
+  &command{"stream", "exchange encoded records as a checked stream over TCP or HTTP", cmd_stream},
+  &command{"key", "list the keys of a key file, or add a new one", cmd_key},
+  &command{"rekey", "encode datasets again under another key, keeping the schema", cmd_rekey},
+  &command{"sign", "write a signed manifest of an encoded file, or generate a signing key", cmd_sign},
+  &command{"verify", "check an encoded file against its signed manifest", cmd_verify},
+  &command{"inspect", "print metadata of an encoded file", cmd_inspect},
+};
+
 func init() {
   flag.BoolVar(&opts.debug, "debug", false, "print debug msg");
-  flag.StringVar(&opts.conf, "conf", "conf/default.json", "path to conf file");
+  flag.BoolVar(&opts.progress, "progress", false, "print progress of each stage");
+  flag.StringVar(&opts.conf, "conf", "conf/default.json", "path to conf file, JSON, YAML (.yaml, .yml) or TOML (.toml)");
+  flag.Var(&opts.set, "set", "override a config key, key=value, repeatable; " + pprl.EnvPrefix + "<KEY> environment variables override as well");
+  flag.StringVar(&opts.out, "out", "", "prefix of encoded output, dataset i is written to <prefix>.<i>");
+  flag.StringVar(&opts.match, "match", "", "path to match output of the first two datasets");
+  flag.StringVar(&opts.format, "format", _format_text, "encoded output format: text or binary");
+}
+
+/* flag set of a subcommand with the common flags */
+func new_flags(name string, o *options) (*flag.FlagSet) {
+  fs := flag.NewFlagSet(name, flag.ContinueOnError);
+  fs.BoolVar(&o.debug, "debug", false, "print debug msg");
+  fs.BoolVar(&o.progress, "progress", false, "print progress of each stage");
+  fs.StringVar(&o.conf, "conf", "conf/default.json", "path to conf file, JSON, YAML (.yaml, .yml) or TOML (.toml)");
+  fs.Var(&o.set, "set", "override a config key, key=value, repeatable; " + pprl.EnvPrefix + "<KEY> environment variables override as well");
+  return fs;
 }
 
+func (s *set_flag) String() (string) {
+  return strings.Join(*s, " ");
+}
+
+func (s *set_flag) Set(value string) (error) {
+  *s = append(*s, value);
+  return nil;
+}
@@ -1,31 +1,167 @@
 package main;
 
+import "context";
+import "errors";
 import "flag";
+import "fmt";
 import "log";
 import "os";
+import "os/signal";
+import "strings";
+import "time";
 
 import "pprl";
 
 func main() {
+  if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+    os.Exit(run_command(os.Args[1], os.Args[2:]));
+  }
+  flag.Usage = usage;
   flag.Parse();
   if flag.NArg() > 0 {
-    flag.PrintDefaults();
-    return;
+    usage();
+    os.Exit(_exit_usage);
   }
-  log.Printf("[%s] initializing config...\n", os.Args[0]);
-  conf, err := pprl.InitConfig(opts.conf, opts.debug);
-  if err != nil {
-    log.Printf("[%s] failed to initialize PPRL procedure: %s\n", os.Args[0], err.Error());
-    return;
+  os.Exit(run_pipeline());
+}
+
+/* dispatch to subcommand */
+func run_command(name string, args []string) (int) {
+  if name == "help" {
+    usage();
+    return _exit_ok;
+  }
+  for _, c := range commands {
+    if c.name == name {
+      return c.run(args);
+    }
+  }
+  log.Printf("[%s] unknown subcommand: %s\n", os.Args[0], name);
+  usage();
+  return _exit_usage;
+}
+
+/* list subcommands and flags of the default pipeline */
+func usage() {
+  out := flag.CommandLine.Output();
+  fmt.Fprintf(out, "usage: %s [flags]\n       %s <subcommand> [flags]\n\nsubcommands:\n", os.Args[0], os.Args[0]);
+  for _, c := range commands {
+    fmt.Fprintf(out, "  %-16s %s\n", c.name, c.usage);
+  }
+  fmt.Fprintf(out, "\nflags without subcommand, run the whole pipeline:\n");
+  flag.PrintDefaults();
+}
+
+/* the whole pipeline, load, encode and optionally write filters and matches */
+func run_pipeline() (int) {
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt);
+  defer stop();
+  conf, code := init_conf(ctx, &opts);
+  if code != _exit_ok {
+    return code;
   }
   log.Printf("[%s] preparing datasets...\n", os.Args[0]);
-  err = conf.PrepareDataset();
+  err := conf.PrepareDatasetContext(ctx);
   if err != nil {
     log.Printf("[%s] failed to prepare dataset: %s\n", os.Args[0], err.Error());
-    return;
+    return exit_code(err, _exit_failure);
   }
   if opts.debug {
     log.Printf("[%s] config content: %v\n", os.Args[0], conf);
   }
   conf.PrintMeta();
+  if opts.out != "" {
+    if code = write_all_filters(conf, opts.out, opts.format); code != _exit_ok {
+      return code;
+    }
+  }
+  if opts.match != "" {
+    result, err := conf.CompareContext(ctx);
+    if err != nil {
+      log.Printf("[%s] failed to compare datasets: %s\n", os.Args[0], err.Error());
+      return exit_code(err, _exit_failure);
+    }
+    if err = write_matches(result.Match, opts.match); err != nil {
+      log.Printf("[%s] failed to write matches: %s\n", os.Args[0], err.Error());
+      return _exit_output;
+    }
+    log.Printf("[%s] %d matches out of %d candidates written to %s, %d dropped by assignment\n", os.Args[0], len(result.Match), result.Candidate, opts.match, result.Dropped);
+  }
+  return _exit_ok;
+}
+
+/* load config and datasets */
+func init_conf(ctx context.Context, o *options) (*pprl.Config, int) {
+  var progress pprl.ProgressFunc;
+  if o.progress {
+    progress = print_progress;
+  }
+  log.Printf("[%s] initializing config...\n", os.Args[0]);
+  /* check config alone first, so that config errors are told apart from data errors */
+  if _, err := pprl.LoadConfig(o.conf, o.set, o.debug); err != nil {
+    log.Printf("[%s] invalid config %s: %s\n", os.Args[0], o.conf, err.Error());
+    return nil, _exit_config;
+  }
+  conf, err := pprl.InitConfigContext(ctx, o.conf, o.set, o.debug, progress);
+  if err != nil {
+    log.Printf("[%s] failed to initialize PPRL procedure: %s\n", os.Args[0], err.Error());
+    return nil, exit_code(err, _exit_data);
+  }
+  return conf, _exit_ok;
+}
+
+/* exit code of an error, interruption wins over the given code */
+func exit_code(err error, code int) (int) {
+  if errors.Is(err, context.Canceled) {
+    return _exit_cancel;
+  }
+  return code;
+}
+
+/* log progress of a stage */
+func print_progress(p pprl.Progress) {
+  percent := float64(100);
+  if p.Total > 0 {
+    percent = float64(p.Done) / float64(p.Total) * 100;
+  }
+  log.Printf("[%s] %s (dataset %d): %d/%d (%.0f%%), elapsed %s, eta %s\n", os.Args[0], p.Stage, p.Dataset, p.Done, p.Total, percent, p.Elapsed.Round(time.Millisecond), p.ETA.Round(time.Second));
+}
+
+/* write each dataset to <prefix>.<i>, as text or binary */
+func write_all_filters(conf *pprl.Config, prefix, format string) (int) {
+  for i := 0; i < conf.NumDataset(); i++ {
+    path := fmt.Sprintf("%s.%d", prefix, i);
+    if err := write_filters(conf, i, path, format); err != nil {
+      log.Printf("[%s] failed to write encoded dataset %d: %s\n", os.Args[0], i, err.Error());
+      return _exit_output;
+    }
+    log.Printf("[%s] encoded dataset %d written to %s\n", os.Args[0], i, path);
+  }
+  return _exit_ok;
+}
+
+/* write encoded dataset to file */
+func write_filters(conf *pprl.Config, i int, path, format string) (error) {
+  fp, err := os.Create(path);
+  if err != nil {
+    return err;
+  }
+  defer fp.Close();
+  if format == _format_binary {
+    return pprl.WriteBinary(fp, conf.Meta(i), conf.Filters(i));
+  }
+  return pprl.WriteFilters(fp, conf.Meta(i), conf.Filters(i));
+}
+
+/* write matches to file, stdout if path is empty */
+func write_matches(matches []*pprl.Match, path string) (error) {
+  if path == "" {
+    return pprl.WriteMatches(os.Stdout, matches);
+  }
+  fp, err := os.Create(path);
+  if err != nil {
+    return err;
+  }
+  defer fp.Close();
+  return pprl.WriteMatches(fp, matches);
 }
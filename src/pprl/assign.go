@@ -0,0 +1,223 @@
+package pprl;
+
+import "math";
+import "sort";
+
+/* one-to-one assignment methods */
+const AssignNone = "none";        // keep all matches above threshold
+const AssignGreedy = "greedy";    // best score first
+const AssignOptimal = "optimal";  // maximum total score (hungarian), greedy for large components
+
+/* check an assignment method, empty means none */
+func check_assign(method string) (error) {
+  switch method {
+  case "", AssignNone, AssignGreedy, AssignOptimal:
+    return nil;
+  }
+  return ErrAssign;
+}
+
+/*
+  keep at most one match per record of each set; matches are split into
+  connected components, each solved alone, optimal ones with more than
+  limit records on either side fall back to greedy, which bounds the cost
+  matrix to limit^2 (limit <= 0 for default)
+*/
+func Assign(matches []*Match, method string, limit int) ([]*Match, error) {
+  if err := check_assign(method); err != nil {
+    return nil, err;
+  }
+  if method == "" || method == AssignNone {
+    return matches, nil;
+  }
+  if limit <= 0 {
+    limit = _default_assign_limit;
+  }
+  var kept []*Match;
+  for _, c := range components(matches) {
+    if len(c) == 1 {
+      kept = append(kept, c[0]);
+      continue;
+    }
+    if method == AssignOptimal {
+      kept = append(kept, assign_optimal(c, limit)...);
+    } else {
+      kept = append(kept, assign_greedy(c)...);
+    }
+  }
+  sort_matches(kept);
+  return kept, nil;
+}
+
+/* connected components of the bipartite match graph, linked by shared LineA or LineB */
+func components(matches []*Match) ([][]*Match) {
+  parent := make([]int, len(matches));
+  for i := range parent {
+    parent[i] = i;
+  }
+  find := func(i int) (int) {
+    for parent[i] != i {
+      parent[i] = parent[parent[i]];
+      i = parent[i];
+    }
+    return i;
+  };
+  first_a := make(map[int]int);
+  first_b := make(map[int]int);
+  for i, m := range matches {
+    if j, ok := first_a[(*m).LineA]; ok {
+      parent[find(i)] = find(j);
+    } else {
+      first_a[(*m).LineA] = i;
+    }
+    if j, ok := first_b[(*m).LineB]; ok {
+      parent[find(i)] = find(j);
+    } else {
+      first_b[(*m).LineB] = i;
+    }
+  }
+  /* components in the order of their first match */
+  index := make(map[int]int);
+  var result [][]*Match;
+  for i, m := range matches {
+    root := find(i);
+    c, ok := index[root];
+    if !ok {
+      c = len(result);
+      index[root] = c;
+      result = append(result, nil);
+    }
+    result[c] = append(result[c], m);
+  }
+  return result;
+}
+
+/* best score first, ties broken by line numbers */
+func assign_greedy(matches []*Match) ([]*Match) {
+  sorted := append([]*Match{}, matches...);
+  sort.Slice(sorted, func(i, j int) (bool) {
+    if (*sorted[i]).Score != (*sorted[j]).Score {
+      return (*sorted[i]).Score > (*sorted[j]).Score;
+    }
+    if (*sorted[i]).LineA != (*sorted[j]).LineA {
+      return (*sorted[i]).LineA < (*sorted[j]).LineA;
+    }
+    return (*sorted[i]).LineB < (*sorted[j]).LineB;
+  });
+  used_a := make(map[int]bool);
+  used_b := make(map[int]bool);
+  var kept []*Match;
+  for _, m := range sorted {
+    if used_a[(*m).LineA] || used_b[(*m).LineB] {
+      continue;
+    }
+    used_a[(*m).LineA] = true;
+    used_b[(*m).LineB] = true;
+    kept = append(kept, m);
+  }
+  return kept;
+}
+
+/* maximum total score with the hungarian method, O(n^2 m) for n <= m records per side */
+func assign_optimal(matches []*Match, limit int) ([]*Match) {
+  row := make(map[int]int);
+  col := make(map[int]int);
+  for _, m := range matches {
+    if _, ok := row[(*m).LineA]; !ok {
+      row[(*m).LineA] = len(row);
+    }
+    if _, ok := col[(*m).LineB]; !ok {
+      col[(*m).LineB] = len(col);
+    }
+  }
+  transpose := len(row) > len(col);
+  n, m := len(row), len(col);
+  if transpose {
+    n, m = m, n;
+  }
+  /* m >= n, so both sides are within limit */
+  if m > limit {
+    return assign_greedy(matches);
+  }
+  /* cost is the negative score, pairs without a match cost 0 and are dropped afterwards */
+  cost := make([][]float64, n);
+  for i := range cost {
+    cost[i] = make([]float64, m);
+  }
+  pair := make(map[[2]int]*Match);
+  for _, x := range matches {
+    i, j := row[(*x).LineA], col[(*x).LineB];
+    if transpose {
+      i, j = j, i;
+    }
+    cost[i][j] = -(*x).Score;
+    pair[[2]int{i, j}] = x;
+  }
+  var kept []*Match;
+  for i, j := range hungarian(cost, n, m) {
+    if x, ok := pair[[2]int{i, j}]; ok {
+      kept = append(kept, x);
+    }
+  }
+  return kept;
+}
+
+/* minimum cost assignment of n rows to m >= n columns, returns column of each row */
+func hungarian(cost [][]float64, n, m int) ([]int) {
+  /* potentials and matching are 1-indexed, p[j] is the row of column j */
+  u := make([]float64, n + 1);
+  v := make([]float64, m + 1);
+  p := make([]int, m + 1);
+  way := make([]int, m + 1);
+  minv := make([]float64, m + 1);
+  used := make([]bool, m + 1);
+  for i := 1; i <= n; i++ {
+    p[0] = i;
+    j0 := 0;
+    for j := range minv {
+      minv[j] = math.Inf(1);
+      used[j] = false;
+    }
+    for p[j0] != 0 {
+      used[j0] = true;
+      i0 := p[j0];
+      delta := math.Inf(1);
+      j1 := 0;
+      for j := 1; j <= m; j++ {
+        if used[j] {
+          continue;
+        }
+        cur := cost[i0 - 1][j - 1] - u[i0] - v[j];
+        if cur < minv[j] {
+          minv[j] = cur;
+          way[j] = j0;
+        }
+        if minv[j] < delta {
+          delta = minv[j];
+          j1 = j;
+        }
+      }
+      for j := 0; j <= m; j++ {
+        if used[j] {
+          u[p[j]] += delta;
+          v[j] -= delta;
+        } else {
+          minv[j] -= delta;
+        }
+      }
+      j0 = j1;
+    }
+    for j0 != 0 {
+      j1 := way[j0];
+      p[j0] = p[j1];
+      j0 = j1;
+    }
+  }
+  result := make([]int, n);
+  for j := 1; j <= m; j++ {
+    if p[j] != 0 {
+      result[p[j] - 1] = j - 1;
+    }
+  }
+  return result;
+}
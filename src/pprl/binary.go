@@ -0,0 +1,295 @@
+package pprl;
+
+import "bufio";
+import "bytes";
+import "crypto/sha256";
+import "encoding/json";
+import "fmt";
+import "io";
+import "os";
+import "strings";
+
+import "util/tannhauser/numbers";
+
+/*
+  binary container of encoded records, all integers little endian:
+
+    0   8   magic "PPRLBF01"
+    8   4   header size, rows start here (8-byte aligned)
+    12  4   #byte per row, ceil(bloom_bit / 8)
+    16  4   bloom_bit
+    20  4   length of metadata JSON
+    24  8   #record
+    32  32  schema hash, sha256 of bloom_bit, ngram, hash, field, key_id and hash_seed
+    64  ..  metadata JSON (Meta, with hardening, key and blocking), zero padded
+    rows        #record * #byte per row, bloom filters
+    lines       #record * 4, line numbers
+    id offsets  (#record + 1) * 8, id i spans [offset i, offset i + 1) of the id table
+    id table    identifiers back to back
+*/
+const _binary_magic = "PPRLBF01";
+const _binary_fixed = 64;         // size of the fixed part of the header
+
+/* encoded records read from a binary container, rows are used in place */
+type BinaryFile struct {
+  Meta *Meta;                   // metadata
+  Schema [sha256.Size]byte;     // schema hash in header
+  data []byte;                  // whole file, mapped or read
+  rows []byte;                  // row section
+  row int;                      // #byte per row
+  lines []byte;                 // line section
+  offsets []byte;               // id offset section
+  ids []byte;                   // id table
+  count int;                    // #record
+  unmap func([]byte) (error);   // release data, nil if read into memory
+}
+
+/* hash of the fields that decide encoding, records with equal hashes are comparable */
+func SchemaHash(meta *Meta) ([sha256.Size]byte) {
+  schema, _ := json.Marshal(&Meta {
+    Mb: (*meta).Mb,
+    Ngram: (*meta).Ngram,
+    K: (*meta).K,
+    Field: (*meta).Field,
+    KeyId: (*meta).KeyId,
+    Seed: meta_seed((*meta).Seed),
+  });
+  return sha256.Sum256(schema);
+}
+
+/* json names of the fields in SchemaHash that differ between a and b, none if comparable */
+func SchemaDiff(a, b *Meta) ([]string) {
+  var diff []string;
+  if (*a).Mb != (*b).Mb {
+    diff = append(diff, "bloom_bit");
+  }
+  if (*a).Ngram != (*b).Ngram {
+    diff = append(diff, "ngram");
+  }
+  if fmt.Sprint((*a).K) != fmt.Sprint((*b).K) {
+    diff = append(diff, "hash");
+  }
+  if strings.Join((*a).Field, ",") != strings.Join((*b).Field, ",") || len((*a).Field) != len((*b).Field) {
+    diff = append(diff, "field");
+  }
+  if (*a).KeyId != (*b).KeyId {
+    diff = append(diff, "key_id");
+  }
+  if a.HashSeed() != b.HashSeed() {
+    diff = append(diff, "hash_seed");
+  }
+  return diff;
+}
+
+/* write filters as a binary container */
+func WriteBinary(w io.Writer, meta *Meta, filters []*Filter) (error) {
+  m := *meta;
+  m.Count = len(filters);
+  header, err := json.Marshal(&m);
+  if err != nil {
+    return err;
+  }
+  row := (m.Mb + 7) / 8;
+  size := align8(_binary_fixed + len(header));
+  fixed := make([]byte, _binary_fixed);
+  copy(fixed, _binary_magic);
+  numbers.PutUi32L(fixed[8:], uint32(size));
+  numbers.PutUi32L(fixed[12:], uint32(row));
+  numbers.PutUi32L(fixed[16:], uint32(m.Mb));
+  numbers.PutUi32L(fixed[20:], uint32(len(header)));
+  numbers.PutUi64L(fixed[24:], uint64(m.Count));
+  schema := SchemaHash(&m);
+  copy(fixed[32:], schema[:]);
+  /* write errors stick to bw and come out of Flush */
+  bw := bufio.NewWriter(w);
+  bw.Write(fixed);
+  bw.Write(header);
+  bw.Write(make([]byte, size - _binary_fixed - len(header)));
+  for _, f := range filters {
+    if len((*f).Bits) != row {
+      return ErrIndexBit;
+    }
+    bw.Write((*f).Bits);
+  }
+  buf := make([]byte, 8);
+  for _, f := range filters {
+    numbers.PutUi32L(buf, uint32((*f).Line));
+    bw.Write(buf[:4]);
+  }
+  offset := uint64(0);
+  numbers.PutUi64L(buf, offset);
+  bw.Write(buf);
+  for _, f := range filters {
+    offset += uint64(len((*f).Id));
+    numbers.PutUi64L(buf, offset);
+    bw.Write(buf);
+  }
+  for _, f := range filters {
+    if _, err = bw.WriteString((*f).Id); err != nil {
+      return err;
+    }
+  }
+  return bw.Flush();
+}
+
+/* map a binary container, or read it where mapping is not supported */
+func OpenBinary(path string) (*BinaryFile, error) {
+  fp, err := os.Open(path);
+  if err != nil {
+    return nil, err;
+  }
+  defer fp.Close();
+  data, unmap, err := map_file(fp);
+  if err != nil {
+    return nil, err;
+  }
+  b, err := ReadBinary(data);
+  if err != nil {
+    if unmap != nil {
+      unmap(data);
+    }
+    return nil, err;
+  }
+  (*b).unmap = unmap;
+  return b, nil;
+}
+
+/* container in memory, data is used in place */
+func ReadBinary(data []byte) (*BinaryFile, error) {
+  if len(data) < _binary_fixed || string(data[:8]) != _binary_magic {
+    return nil, ErrBinaryFormat;
+  }
+  size := int(numbers.B2Uint32L(data[8:12]));
+  row := int(numbers.B2Uint32L(data[12:16]));
+  mb := int(numbers.B2Uint32L(data[16:20]));
+  meta_len := int(numbers.B2Uint32L(data[20:24]));
+  count64 := numbers.B2Uint64L(data[24:32]);
+  if size < _binary_fixed + meta_len || size > len(data) || mb <= 0 || row != (mb + 7) / 8 || count64 > uint64(len(data)) {
+    return nil, ErrBinaryFormat;
+  }
+  count := int(count64);
+  b := &BinaryFile {
+    Meta: &Meta{},
+    data: data,
+    row: row,
+    count: count,
+  };
+  copy((*b).Schema[:], data[32:64]);
+  if err := json.Unmarshal(data[_binary_fixed:_binary_fixed + meta_len], (*b).Meta); err != nil {
+    return nil, ErrBinaryFormat;
+  }
+  if (*(*b).Meta).Mb != mb || (*(*b).Meta).Count != count {
+    return nil, ErrBinaryFormat;
+  }
+  schema := SchemaHash((*b).Meta);
+  if !bytes.Equal(schema[:], (*b).Schema[:]) {
+    return nil, ErrSchemaHash;
+  }
+  /* sections follow the header back to back */
+  at := size;
+  end := at + count * row;
+  if end > len(data) {
+    return nil, ErrBinaryFormat;
+  }
+  (*b).rows = data[at:end];
+  at, end = end, end + count * 4;
+  if end > len(data) {
+    return nil, ErrBinaryFormat;
+  }
+  (*b).lines = data[at:end];
+  at, end = end, end + (count + 1) * 8;
+  if end > len(data) {
+    return nil, ErrBinaryFormat;
+  }
+  (*b).offsets = data[at:end];
+  (*b).ids = data[end:];
+  if numbers.B2Uint64L((*b).offsets[count * 8:]) != uint64(len((*b).ids)) {
+    return nil, ErrBinaryFormat;
+  }
+  return b, nil;
+}
+
+/* #record */
+func (b *BinaryFile) Len() (int) {
+  return (*b).count;
+}
+
+/* bloom filter of record i, shares memory with the container */
+func (b *BinaryFile) Bits(i int) ([]byte) {
+  return (*b).rows[i * (*b).row:(i + 1) * (*b).row:(i + 1) * (*b).row];
+}
+
+/* line number of record i */
+func (b *BinaryFile) Line(i int) (int) {
+  return int(numbers.B2Uint32L((*b).lines[i * 4:]));
+}
+
+/* identifier of record i */
+func (b *BinaryFile) Id(i int) (string) {
+  from := numbers.B2Uint64L((*b).offsets[i * 8:]);
+  to := numbers.B2Uint64L((*b).offsets[(i + 1) * 8:]);
+  if from > to || to > uint64(len((*b).ids)) {
+    return "";
+  }
+  return string((*b).ids[from:to]);
+}
+
+/* records for comparison, bits are not copied, so the container must stay open */
+func (b *BinaryFile) Filters() ([]*Filter) {
+  filters := make([]*Filter, (*b).count);
+  for i := range filters {
+    filters[i] = &Filter {
+      Id: b.Id(i),
+      Line: b.Line(i),
+      Bits: b.Bits(i),
+    };
+  }
+  return filters;
+}
+
+/* records in order one at a time, bits are not copied, so the container must stay open */
+func (b *BinaryFile) Source() (FilterSource) {
+  return &binary_source{b: b};
+}
+
+/* FilterSource over a container */
+type binary_source struct {
+  b *BinaryFile;
+  next int;                     // next record
+}
+
+func (s *binary_source) Next() (*Filter, error) {
+  if (*s).next >= (*(*s).b).count {
+    return nil, io.EOF;
+  }
+  i := (*s).next;
+  (*s).next++;
+  return &Filter {
+    Id: (*s).b.Id(i),
+    Line: (*s).b.Line(i),
+    Bits: (*s).b.Bits(i),
+  }, nil;
+}
+
+/* release the mapping, filters from Filters are invalid afterwards */
+func (b *BinaryFile) Close() (error) {
+  if (*b).unmap == nil {
+    return nil;
+  }
+  err := (*b).unmap((*b).data);
+  (*b).unmap = nil;
+  (*b).data = nil;
+  (*b).rows = nil;
+  return err;
+}
+
+/* whether r starts with the binary container magic, r is not consumed */
+func IsBinary(r *bufio.Reader) (bool) {
+  head, err := r.Peek(len(_binary_magic));
+  return err == nil && string(head) == _binary_magic;
+}
+
+/* round up to a multiple of 8 */
+func align8(n int) (int) {
+  return (n + 7) / 8 * 8;
+}
@@ -0,0 +1,316 @@
+package pprl;
+
+import "bytes";
+import "context";
+import "crypto/sha256";
+import "encoding/hex";
+import "encoding/json";
+import "fmt";
+import "io";
+import "net/http";
+import "net/url";
+import "strconv";
+import "time";
+
+/* custodian side of a linkage unit, see Server */
+type Client struct {
+  Base string;                  // server URL, e.g. http://lu:8080
+  Token string;                 // party token, or admin token to create projects
+  HTTP *http.Client;            // http client, http.DefaultClient if nil
+  Chunk int64;                  // #byte per upload request
+  Retry int;                    // #retry of a failed request
+  Backoff time.Duration;        // wait before the first retry, doubled each time
+  Progress func(done, total int64); // upload progress, can be nil
+}
+
+/* reply of the server other than success */
+type HTTPError struct {
+  Code int;                     // http status
+  Message string;               // error message of the server
+}
+
+/* default client configs */
+const _default_chunk = 8 << 20;
+const _default_retry = 5;
+const _default_backoff = time.Second;
+
+func (e *HTTPError) Error() (string) {
+  return fmt.Sprintf("server replied %d: %s", (*e).Code, (*e).Message);
+}
+
+/* client with default chunk size and retries */
+func NewClient(base, token string) (*Client) {
+  return &Client {
+    Base: base,
+    Token: token,
+    Chunk: _default_chunk,
+    Retry: _default_retry,
+    Backoff: _default_backoff,
+  };
+}
+
+/* create a project, the token must be the admin token if the server has one */
+func (c *Client) CreateProject(ctx context.Context, req *ProjectRequest) (*ProjectResponse, error) {
+  body, err := json.Marshal(req);
+  if err != nil {
+    return nil, err;
+  }
+  resp := &ProjectResponse{};
+  if _, err = c.call(ctx, http.MethodPost, "/projects", body, resp); err != nil {
+    return nil, err;
+  }
+  return resp, nil;
+}
+
+/* state of a project */
+func (c *Client) Status(ctx context.Context, project string) (*ProjectStatus, error) {
+  st := &ProjectStatus{};
+  if _, err := c.call(ctx, http.MethodGet, "/projects/" + url.PathEscape(project), nil, st); err != nil {
+    return nil, err;
+  }
+  return st, nil;
+}
+
+/*
+  upload size bytes of r as the records of party; starts from what the
+  server already has, so an interrupted upload resumes where it stopped
+*/
+func (c *Client) Upload(ctx context.Context, project, party string, r io.ReaderAt, size int64) (*PartyStatus, error) {
+  st, err := c.Status(ctx, project);
+  if err != nil {
+    return nil, err;
+  }
+  ps, ok := (*st).Party[party];
+  if !ok {
+    return nil, &HTTPError{http.StatusNotFound, "no such party " + party};
+  }
+  if (*ps).Complete {
+    return ps, nil;
+  }
+  chunk := (*c).Chunk;
+  if chunk <= 0 {
+    chunk = _default_chunk;
+  }
+  path := "/projects/" + url.PathEscape(project) + "/parties/" + url.PathEscape(party);
+  offset := (*ps).Size;
+  if offset > size {
+    return nil, &HTTPError{http.StatusConflict, "server has more bytes than the local file, upload of another file?"};
+  }
+  buf := make([]byte, chunk);
+  for offset < size {
+    n := chunk;
+    if size - offset < n {
+      n = size - offset;
+    }
+    if _, err = r.ReadAt(buf[:n], offset); err != nil && err != io.EOF {
+      return nil, err;
+    }
+    next := &PartyStatus{};
+    code, err := c.call(ctx, http.MethodPut, path + "/filters?offset=" + strconv.FormatInt(offset, 10), buf[:n], next);
+    if err != nil && code != http.StatusConflict {
+      return nil, err;
+    }
+    /* on conflict the server tells where to go on */
+    if (*next).Complete {
+      return next, nil;
+    }
+    if (*next).Size > size {
+      return nil, &HTTPError{http.StatusConflict, "server has more bytes than the local file, upload of another file?"};
+    }
+    offset = (*next).Size;
+    if (*c).Progress != nil {
+      (*c).Progress(offset, size);
+    }
+  }
+  /* the whole file is hashed so that the server can check it */
+  h := sha256.New();
+  if _, err = io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+    return nil, err;
+  }
+  done := &PartyStatus{};
+  if _, err = c.call(ctx, http.MethodPost, path + "/complete?sha256=" + hex.EncodeToString(h.Sum(nil)), nil, done); err != nil {
+    return nil, err;
+  }
+  return done, nil;
+}
+
+/*
+  send the records of src as one stream, see NewStreamReader; records are
+  read and encoded while sent, so the set is never held in memory, but a
+  failed stream is not retried since src cannot start over
+*/
+func (c *Client) Stream(ctx context.Context, project, party string, meta *Meta, src FilterSource) (*PartyStatus, error) {
+  pr, pw := io.Pipe();
+  go func() {
+    _, err := SendStream(pw, meta, src, int((*c).Chunk));
+    pw.CloseWithError(err);
+  }();
+  path := "/projects/" + url.PathEscape(project) + "/parties/" + url.PathEscape(party) + "/stream";
+  req, err := http.NewRequestWithContext(ctx, http.MethodPut, (*c).Base + path, pr);
+  if err != nil {
+    pr.Close();
+    return nil, err;
+  }
+  req.Header.Set("Authorization", "Bearer " + (*c).Token);
+  req.Header.Set("Content-Type", "application/octet-stream");
+  resp, err := c.client().Do(req);
+  pr.Close();
+  if err != nil {
+    return nil, err;
+  }
+  defer resp.Body.Close();
+  if resp.StatusCode != http.StatusOK {
+    /* a stream rejected by the receiver is answered with an error frame */
+    if resp.Header.Get("Content-Type") == "application/octet-stream" {
+      if err = ReadStreamAck(resp.Body, nil); err == nil {
+        err = ErrStreamFormat;
+      }
+      return nil, &HTTPError{resp.StatusCode, err.Error()};
+    }
+    return nil, read_error(resp);
+  }
+  ps := &PartyStatus{};
+  if err = json.NewDecoder(resp.Body).Decode(ps); err != nil {
+    return nil, err;
+  }
+  return ps, nil;
+}
+
+/* start linkage, all parties must have completed their uploads */
+func (c *Client) Match(ctx context.Context, project string) (*ProjectStatus, error) {
+  st := &ProjectStatus{};
+  if _, err := c.call(ctx, http.MethodPost, "/projects/" + url.PathEscape(project) + "/match", nil, st); err != nil {
+    return nil, err;
+  }
+  return st, nil;
+}
+
+/* poll every interval until linkage is done or failed */
+func (c *Client) Wait(ctx context.Context, project string, interval time.Duration) (*ProjectStatus, error) {
+  for {
+    st, err := c.Status(ctx, project);
+    if err != nil {
+      return nil, err;
+    }
+    switch (*st).State {
+    case ProjectDone:
+      return st, nil;
+    case ProjectFailed:
+      return st, &HTTPError{http.StatusInternalServerError, "linkage failed: " + (*st).Error};
+    }
+    select {
+    case <-ctx.Done():
+      return nil, ctx.Err();
+    case <-time.After(interval):
+    }
+  }
+}
+
+/* download the clusters holding records of party, linkage must be done */
+func (c *Client) Results(ctx context.Context, project, party string, w io.Writer) (error) {
+  path := "/projects/" + url.PathEscape(project) + "/parties/" + url.PathEscape(party) + "/results";
+  return c.retry(ctx, func() (int, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, (*c).Base + path, nil);
+    if err != nil {
+      return 0, err;
+    }
+    req.Header.Set("Authorization", "Bearer " + (*c).Token);
+    resp, err := c.client().Do(req);
+    if err != nil {
+      return 0, err;
+    }
+    defer resp.Body.Close();
+    if resp.StatusCode != http.StatusOK {
+      return resp.StatusCode, read_error(resp);
+    }
+    _, err = io.Copy(w, resp.Body);
+    return resp.StatusCode, err;
+  });
+}
+
+/* send a request with retries and decode a JSON reply into out; returns the last status */
+func (c *Client) call(ctx context.Context, method, path string, body []byte, out interface{}) (int, error) {
+  var code int;
+  err := c.retry(ctx, func() (int, error) {
+    req, err := http.NewRequestWithContext(ctx, method, (*c).Base + path, bytes.NewReader(body));
+    if err != nil {
+      return 0, err;
+    }
+    req.Header.Set("Authorization", "Bearer " + (*c).Token);
+    resp, err := c.client().Do(req);
+    if err != nil {
+      return 0, err;
+    }
+    defer resp.Body.Close();
+    code = resp.StatusCode;
+    data, err := io.ReadAll(resp.Body);
+    if err != nil {
+      return 0, err;
+    }
+    if code >= 300 {
+      /* a conflict may carry the state to recover from */
+      if out != nil && code == http.StatusConflict {
+        json.Unmarshal(data, out);
+      }
+      return code, error_body(code, data);
+    }
+    if out != nil {
+      return code, json.Unmarshal(data, out);
+    }
+    return code, nil;
+  });
+  return code, err;
+}
+
+/* run do until it succeeds, fails for good or retries run out; transport errors, 429 and 5xx are retried */
+func (c *Client) retry(ctx context.Context, do func() (int, error)) (error) {
+  wait := (*c).Backoff;
+  var err error;
+  for i := 0; ; i++ {
+    var code int;
+    code, err = do();
+    if err == nil {
+      return nil;
+    }
+    if ctx.Err() != nil {
+      return ctx.Err();
+    }
+    if code != 0 && code != http.StatusTooManyRequests && code < 500 {
+      return err;
+    }
+    if i >= (*c).Retry {
+      return err;
+    }
+    select {
+    case <-ctx.Done():
+      return ctx.Err();
+    case <-time.After(wait):
+    }
+    wait *= 2;
+  }
+}
+
+/* http client in use */
+func (c *Client) client() (*http.Client) {
+  if (*c).HTTP != nil {
+    return (*c).HTTP;
+  }
+  return http.DefaultClient;
+}
+
+/* error of a reply with {"error": msg} body */
+func read_error(resp *http.Response) (error) {
+  data, _ := io.ReadAll(io.LimitReader(resp.Body, 1 << 16));
+  return error_body(resp.StatusCode, data);
+}
+
+/* error from status and body */
+func error_body(code int, data []byte) (error) {
+  var body struct {
+    Error string `json:"error"`;
+  };
+  if json.Unmarshal(data, &body) == nil && body.Error != "" {
+    return &HTTPError{code, body.Error};
+  }
+  return &HTTPError{code, http.StatusText(code)};
+}
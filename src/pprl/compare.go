@@ -0,0 +1,286 @@
+package pprl;
+
+import "bufio";
+import "context";
+import "fmt";
+import "io";
+import "math/bits";
+import "math/rand";
+import "runtime";
+import "sort";
+import "strconv";
+import "strings";
+import "sync/atomic";
+
+import "util/tannhauser/pool";
+
+/* linked pair of records */
+type Match struct {
+  IdA string;                   // identifier of record in the first set
+  IdB string;                   // identifier of record in the second set
+  LineA int;                    // line number of record in the first set
+  LineB int;                    // line number of record in the second set
+  Score float64;                // dice coefficient
+}
+
+/* comparison parameters */
+type CompareOption struct {
+  Mb int;                       // #bit in the bloom filter
+  Blk int;                      // #bit sampled for a block key
+  Iter int;                     // #blocking iteration, each samples different bits
+  Seed int64;                   // seed for bit sampling
+  Threshold float64;            // minimum dice coefficient of a match
+  Assign string;                // one-to-one assignment: none (or empty), greedy or optimal
+  AssignLimit int;              // max #record on either side solved optimally, 0 for default
+  Worker int;                   // #worker
+  Chunk int;                    // #record of the first set per batch, 0 for auto
+  Progress ProgressFunc;        // progress callback, can be nil
+}
+
+/* comparison output */
+type CompareResult struct {
+  Match []*Match;               // matches, ordered by (LineA, LineB)
+  Candidate int64;              // #pair compared after blocking
+  Dropped int;                  // #match above threshold dropped by one-to-one assignment
+}
+
+/* comparison option with default blocking and threshold */
+func NewCompareOption(mb int) (*CompareOption) {
+  return &CompareOption {
+    Mb: mb,
+    Blk: _default_block,
+    Iter: _default_block_iter,
+    Threshold: _default_threshold,
+    Worker: runtime.GOMAXPROCS(0),
+  };
+}
+
+/* comparison option from config */
+func (cf *Config) compare_option() (*CompareOption) {
+  return &CompareOption {
+    Mb: (*cf).Mb,
+    Blk: (*cf).Blk,
+    Iter: (*cf).BlockIter,
+    Seed: (*cf).BlockSeed,
+    Threshold: (*(*cf).Threshold),
+    Assign: (*cf).Assign,
+    AssignLimit: (*cf).AssignLimit,
+    Worker: (*cf).workers.Size(),
+    Chunk: (*cf).Chunk,
+    Progress: (*cf).progress,
+  };
+}
+
+/* compare the first two datasets */
+func (cf *Config) Compare() (*CompareResult, error) {
+  return cf.CompareContext(context.Background());
+}
+
+/* compare the first two datasets until ctx is done */
+func (cf *Config) CompareContext(ctx context.Context) (*CompareResult, error) {
+  if (*cf).nd < 2 {
+    return nil, ErrCompareDataset;
+  }
+  return CompareContext(ctx, cf.Filters(0), cf.Filters(1), cf.compare_option());
+}
+
+/* compare two sets of filters, blocking with hamming LSH (bit sampling) */
+func Compare(a, b []*Filter, opt *CompareOption) (*CompareResult) {
+  result, _ := CompareContext(context.Background(), a, b, opt);
+  return result;
+}
+
+/* compare two sets of filters until ctx is done */
+func CompareContext(ctx context.Context, a, b []*Filter, opt *CompareOption) (*CompareResult, error) {
+  positions := sample_bits(opt);
+  return compare_index(ctx, a, b, opt, positions, block_index(b, positions));
+}
+
+/* compare a against b, blocked by index built from b on positions */
+func compare_index(ctx context.Context, a, b []*Filter, opt *CompareOption, positions [][]int, index []map[uint64][]int) (*CompareResult, error) {
+  result := &CompareResult{};
+  /* matches are kept per record of the first set, each only touched by one worker */
+  found := make([][]*Match, len(a));
+  candidate, err := scan_index(ctx, a, b, opt, positions, index, func(i, j int, score float64) {
+    if score >= (*opt).Threshold {
+      found[i] = append(found[i], &Match {
+        IdA: (*a[i]).Id,
+        IdB: (*b[j]).Id,
+        LineA: (*a[i]).Line,
+        LineB: (*b[j]).Line,
+        Score: score,
+      });
+    }
+  });
+  if err != nil {
+    return nil, err;
+  }
+  (*result).Candidate = candidate;
+  for _, m := range found {
+    (*result).Match = append((*result).Match, m...);
+  }
+  total := len((*result).Match);
+  if (*result).Match, err = Assign((*result).Match, (*opt).Assign, (*opt).AssignLimit); err != nil {
+    return nil, err;
+  }
+  (*result).Dropped = total - len((*result).Match);
+  sort_matches((*result).Match);
+  return result, nil;
+}
+
+/* call visit on every candidate pair (a[i], b[j]) after blocking, concurrently for different i; returns #candidate */
+func scan_candidates(ctx context.Context, a, b []*Filter, opt *CompareOption, visit func(i, j int, score float64)) (int64, error) {
+  positions := sample_bits(opt);
+  return scan_index(ctx, a, b, opt, positions, block_index(b, positions), visit);
+}
+
+/* block tables of a set, one per sampled positions, mapping block key to filter index */
+func block_index(b []*Filter, positions [][]int) ([]map[uint64][]int) {
+  index := make([]map[uint64][]int, len(positions));
+  for t := range positions {
+    index[t] = make(map[uint64][]int);
+  }
+  add_block(index, b, positions, 0);
+  return index;
+}
+
+/* add filters to block tables, the first one at index offset */
+func add_block(index []map[uint64][]int, b []*Filter, positions [][]int, offset int) {
+  for t, pos := range positions {
+    for j, f := range b {
+      key := block_key((*f).Bits, pos);
+      index[t][key] = append(index[t][key], offset + j);
+    }
+  }
+}
+
+/* scan_candidates with block tables of b already built */
+func scan_index(ctx context.Context, a, b []*Filter, opt *CompareOption, positions [][]int, index []map[uint64][]int, visit func(i, j int, score float64)) (int64, error) {
+  /* compare a batch of the first set per worker */
+  var candidate int64;
+  workers := &pool.WorkerPool{};
+  workers.InitWorkerPool((*opt).Worker, (*opt).Chunk);
+  progress := new_progress((*opt).Progress, StageCompare, -1, int64(len(a)));
+  err := workers.RunContext(ctx, len(a), func(start, end int) {
+    var cand []int;
+    var cnt int64;
+    for i := start; i < end; i++ {
+      f := a[i];
+      cand = cand[:0];
+      for t, pos := range positions {
+        cand = append(cand, index[t][block_key((*f).Bits, pos)]...);
+      }
+      sort.Ints(cand);
+      for c, j := range cand {
+        if c > 0 && cand[c - 1] == j {
+          continue;
+        }
+        cnt++;
+        visit(i, j, dice((*f).Bits, (*b[j]).Bits));
+      }
+    }
+    atomic.AddInt64(&candidate, cnt);
+    progress.add(int64(end - start));
+  });
+  return candidate, err;
+}
+
+/* deterministic order of matches */
+func sort_matches(m []*Match) {
+  sort.Slice(m, func(i, j int) (bool) {
+    if (*m[i]).LineA != (*m[j]).LineA {
+      return (*m[i]).LineA < (*m[j]).LineA;
+    }
+    return (*m[i]).LineB < (*m[j]).LineB;
+  });
+}
+
+/* sampled bit positions for each blocking iteration */
+func sample_bits(opt *CompareOption) ([][]int) {
+  iter := (*opt).Iter;
+  blk := (*opt).Blk;
+  if blk > (*opt).Mb {
+    blk = (*opt).Mb;
+  }
+  if blk <= 0 || iter <= 0 {
+    /* no blocking, a single block for all */
+    return [][]int{[]int{}};
+  }
+  r := rand.New(rand.NewSource((*opt).Seed));
+  positions := make([][]int, iter);
+  for t := 0; t < iter; t++ {
+    positions[t] = r.Perm((*opt).Mb)[:blk];
+    sort.Ints(positions[t]);
+  }
+  return positions;
+}
+
+/* block key from sampled bits, at most 64 bits are used */
+func block_key(filter []byte, pos []int) (uint64) {
+  key := uint64(0);
+  for i, p := range pos {
+    if i >= 64 {
+      break;
+    }
+    if filter[p / 8] & (uint8(1) << uint8(p % 8)) != 0 {
+      key |= uint64(1) << uint64(i);
+    }
+  }
+  return key;
+}
+
+/* dice coefficient of two bloom filters */
+func dice(a, b []byte) (float64) {
+  common := 0;
+  total := 0;
+  for i := 0; i < len(a) && i < len(b); i++ {
+    common += bits.OnesCount8(a[i] & b[i]);
+    total += bits.OnesCount8(a[i]) + bits.OnesCount8(b[i]);
+  }
+  if total == 0 {
+    return 0;
+  }
+  return float64(2 * common) / float64(total);
+}
+
+/* read matches written by WriteMatches */
+func ReadMatches(r io.Reader) ([]*Match, error) {
+  var matches []*Match;
+  scanner := bufio.NewScanner(r);
+  for scanner.Scan() {
+    column := strings.Split(scanner.Text(), ",");
+    if len(column) != 5 {
+      return nil, ErrMatchFormat;
+    }
+    m := &Match {
+      IdA: unescape_id(column[0]),
+      IdB: unescape_id(column[1]),
+    };
+    var err error;
+    if (*m).LineA, err = strconv.Atoi(column[2]); err != nil {
+      return nil, ErrMatchFormat;
+    }
+    if (*m).LineB, err = strconv.Atoi(column[3]); err != nil {
+      return nil, ErrMatchFormat;
+    }
+    if (*m).Score, err = strconv.ParseFloat(column[4], 64); err != nil {
+      return nil, ErrMatchFormat;
+    }
+    matches = append(matches, m);
+  }
+  if err := scanner.Err(); err != nil {
+    return nil, err;
+  }
+  return matches, nil;
+}
+
+/* write matches as "id_a,id_b,line_a,line_b,score" lines */
+func WriteMatches(w io.Writer, matches []*Match) (error) {
+  bw := bufio.NewWriter(w);
+  for _, m := range matches {
+    if _, err := fmt.Fprintf(bw, "%s,%s,%d,%d,%.6f\n", escape_id((*m).IdA), escape_id((*m).IdB), (*m).LineA, (*m).LineB, (*m).Score); err != nil {
+      return err;
+    }
+  }
+  return bw.Flush();
+}
@@ -1,11 +1,14 @@
 package pprl;
 
 import "bufio";
-import "crypto/md5";
+import "context";
+import "encoding/json";
 import "hash";
+import "io";
 import "log";
 import "math";
 import "os";
+import "runtime";
 import "strconv";
 import "strings";
 import "sync";
@@ -18,7 +21,7 @@ type Config struct {
   /* exported fields, for JSON config */
   Dataset string `json:"dataset"`;  // path to datasets, separated by ","
   Prefix string `json:"prefix"`;    // prefix to datasets
-  Size string `json:"size"`;        // #record for each dataset, separated by ","
+  Size string `json:"size"`;        // expected #record for each dataset, separated by ",", optional capacity hint
   Ignore string `json:"ignore"`;    // index of field to be ignored, separated by ",", begins from 0
   Buffer int `json:"buffer"`;       // #buffer in resource pool
   Hash int `json:"hash"`;           // #hash buffer in resource pool
@@ -26,8 +29,20 @@ type Config struct {
   Ng *int `json:"ngram"`;           // n for n-gram
   Mb int `json:"bloom_bit"`;        // #bit in the result bloom filter
   Blk int `json:"block_bit"`;       // #bit for block
-  MaxGo int `json:"max_routine"`;   // max number of go routine
+  MaxGo int `json:"max_routine"`;   // max number of go routine, capped by GOMAXPROCS
+  Chunk int `json:"chunk"`;         // #record per batch of a worker, 0 for auto
   Ratio *float64 `json:"ratio"`;     // ratio of on bits in resulting bloom filter
+  MinK int `json:"min_hash"`;       // minimum #hash for each field
+  MaxK int `json:"max_hash"`;       // maximum #hash for each field
+  IdField *int `json:"id_field"`;   // index of field used as record identifier, line number if not set
+  BlockIter int `json:"block_iter"`; // #blocking iteration
+  BlockSeed int64 `json:"block_seed"`; // seed for sampling block bits
+  Threshold *float64 `json:"threshold"`; // minimum dice coefficient of a match
+  Assign string `json:"assign"`;    // one-to-one assignment of matches: none, greedy or optimal
+  AssignLimit int `json:"assign_limit"`; // max #record on either side solved optimally, larger components go greedy
+  KeyFile string `json:"key_file"`; // key file for keyed hashing, unkeyed md5 if empty
+  KeyId string `json:"key_id"`;     // key of key_file to encode with, the newest if empty
+  HashSeed string `json:"hash_seed"`; // seeding of the hash methods: prefix, or padding as in older versions
 
   /* data instance */
   fp []*os.File;                    // file pointer for datasets
@@ -45,6 +60,14 @@ type Config struct {
   g []float64;                      // array of average n gram length for each field of each dataset
   k []int;                          // array of #hash for each field
   m []int;                          // array of #m-bits for each field
+  workers *pool.WorkerPool;         // worker pool for parallel processing
+  enc *encoder;                     // encoding resources
+  progress ProgressFunc;            // progress callback
+  plan *Plan;                       // encoding parameters with estimations
+  analyzed bool;                    // field statistics and n-grams are done
+  keys *KeyFile;                    // keys of key_file, nil if unkeyed
+  key *Key;                         // key in use, nil if unkeyed
+  set []string;                     // key=value overrides, over the config file and environment
 }
 
 type Dataset struct {
@@ -59,14 +82,20 @@ type Dataset struct {
   nr int;                       // #record
   nf *int;                      // #field
   ignore *[]bool;               // pointer to Dataset.ignore
+  workers *pool.WorkerPool;     // pointer to Config.workers
+  enc **encoder;                // pointer to Config.enc
+  progress *ProgressFunc;       // pointer to Config.progress
+  index int;                    // index in Config.dataset
+  size int;                     // #record expected from the size config, 0 if unknown
   debug *bool;                  // pointer to Config.debug
   g []float64;                  // array of average n gram length for each field
 }
 
 type Record struct {
+  id string;                    // source identifier
+  line int;                     // line number in source file
   field []*Field;               // field data
   bloom_filter []byte           // bloom filter
-  block []int                   // block number
 }
 
 type Field struct {
@@ -91,6 +120,14 @@ type FieldMeta struct {
   sum_n_gram float64;           // sum of n gram length for the certain field
 }
 
+/* encoding resources owned by a Config */
+type encoder struct {
+  buffers Buffers;              // line splitting buffers
+  hashes Hashes;                // hash instances
+  bloom_table [][]byte;         // bloom filter with only the i-th bit on
+  seed string;                  // seeding of the hash methods, SeedPrefix or SeedPadding
+}
+
 type Buffers struct {
   index *pool.IndexPool;
   buffer []*Buffer;
@@ -99,6 +136,7 @@ type Buffers struct {
 type Buffer struct {
   Index int;
   field_buffer []string;
+  pool *Buffers;                // owner of the buffer
 }
 
 type Hashes struct {
@@ -109,20 +147,10 @@ type Hashes struct {
 type Hash struct {
   Index int;
   hash hash.Hash;               // actual hash instance
-}
-
-type go_pool_st struct {
-  index *pool.IndexPool;
-  pool []*go_st;
-}
-
-type go_st struct {
-  index int;
-}
-
-type progress_wait_group struct {
-  total int32;
-  wg sync.WaitGroup;
+  pool *Hashes;                 // owner of the hash
+  enc *encoder;                 // encoder of the hash
+  prefix [4]byte;               // seed of SeedPrefix
+  sum []byte;                   // hash value, reused
 }
 
 type Error string;
@@ -134,6 +162,48 @@ const ErrSize = Error("invalid size value");
 const ErrInvalidIgnore = Error("invalid ignore index");
 const ErrMb = Error("#bit larger than predefined #bit of bloom filter");
 const ErrMbDistribution = Error("failed to redistribute remaining bits");
+const ErrRatio = Error("ratio should be within (0, 1)");
+const ErrHashRange = Error("invalid min_hash/max_hash, should be 1 <= min_hash <= max_hash");
+const ErrNoField = Error("no field left for encoding, check ignore");
+const ErrZeroWeight = Error("all fields have zero entropy");
+const ErrNoBit = Error("no bit assigned due to zero weight, consider ignoring the field");
+const ErrTooFewBit = Error("less than 2 bits assigned, increase bloom_bit");
+const ErrNoNgram = Error("no n-gram found, field is empty in all datasets");
+const ErrIdField = Error("invalid id_field");
+const ErrCompareDataset = Error("at least 2 datasets are required for comparison");
+const ErrRecordField = Error("record has less fields than num_field");
+const ErrFilterFormat = Error("invalid encoded record format");
+const ErrFilterCount = Error("#encoded record differs from count in metadata");
+const ErrMatchFormat = Error("invalid match format");
+const ErrFieldIndex = Error("field index out of range");
+const ErrDatasetIndex = Error("dataset index out of range");
+const ErrNotAnalyzed = Error("datasets are not analyzed yet");
+const ErrAssign = Error("invalid assign, should be none, greedy or optimal");
+const ErrSchema = Error("datasets do not match the schema of the encoded index");
+const ErrIndexBit = Error("#bit of encoded records differs from the index");
+const ErrBinaryFormat = Error("invalid binary container of encoded records");
+const ErrSchemaHash = Error("schema hash of binary container does not match its metadata");
+const ErrGenerateSize = Error("#record of generated datasets should be positive");
+const ErrGenerateRatio = Error("overlap and corrupt should be within [0, 1], duplicate within [0, 1)");
+const ErrCorruptModel = Error("invalid corruption model, weights should be non-negative and not all zero");
+const ErrStreamFormat = Error("invalid stream of encoded records");
+const ErrStreamChecksum = Error("checksum of stream frame differs, data corrupted in transfer");
+const ErrStreamManifest = Error("stream does not match its manifest");
+const ErrKeyFormat = Error("invalid ed25519 key");
+const ErrSignature = Error("signature does not verify");
+const ErrSigner = Error("not signed by the trusted key");
+const ErrManifest = Error("encoded records differ from the signed manifest");
+const ErrKeyFile = Error("invalid key file");
+const ErrKeyId = Error("unknown or duplicate key id");
+const ErrKeyAlgorithm = Error("unsupported key algorithm, should be hmac-sha256");
+const ErrKeyMismatch = Error("encoded records were made under another key");
+const ErrInvalidNgram = Error("invalid ngram");
+const ErrBlock = Error("invalid blocking parameter");
+const ErrThreshold = Error("threshold should be within [0, 1]");
+const ErrNegative = Error("value should not be negative");
+const ErrHashSeed = Error("invalid hash_seed, should be prefix or padding");
+const ErrSeedMismatch = Error("encoded records were made with another hash_seed");
+const ErrSchemaMismatch = Error("encoded records were made under another schema");
 
 /* default configs */
 const _default_buffer_pool = 10;
@@ -143,16 +213,26 @@ const _default_mb = 1024;
 const _default_block = 4;
 const _default_go_routine = 4096;
 const _default_ratio = float64(0.5);
+const _default_min_hash = 1;
+const _default_max_hash = 32;
+const _default_block_iter = 8;
+const _default_threshold = float64(0.8);
+const _default_assign_limit = 256;
+const _default_hash_seed = SeedPrefix;
 
-/* internal structure */
-const _padding_tbl_size = 11;
+/* most records reserved up front from a size hint, more are appended as loaded */
+const _max_record_hint = 1 << 20;
+
+/* environment variables overriding config keys, e.g. PPRL_BLOOM_BIT for bloom_bit */
+const EnvPrefix = "PPRL_";
 
-/* global variables */
-var buffers Buffers;
-var hashes Hashes;
-var bloom_table [][]byte;
-var go_pool go_pool_st;
-var padding_tbl []string;
+/* seeding of hash method i of a field */
+const SeedPrefix = "prefix";      // i as 4 little endian bytes before the n-gram
+const SeedPadding = "padding";    // i "*" before the n-gram, the padded md5 of older versions
+
+/* internal structure */
+const _padding = "****************************************************************";
+const _cancel_check = 4096;       // #line between cancellation checks when loading
 
 /* for constant error */
 func (e Error) Error() (string) {
@@ -161,16 +241,39 @@ func (e Error) Error() (string) {
 
 /* get default config */
 func InitConfig(path string, debug bool) (*Config, error) {
+  return InitConfigContext(context.Background(), path, nil, debug, nil);
+}
+
+/*
+  get default config with key=value overrides in set, loading can be
+  cancelled by ctx and reported through progress
+*/
+func InitConfigContext(ctx context.Context, path string, set []string, debug bool, progress ProgressFunc) (*Config, error) {
+  cf := &Config {
+    conf: path,
+    set: set,
+    debug: debug,
+    workers: &pool.WorkerPool{},
+    progress: progress,
+  };
+  err := cf.init_resource(ctx);
+  return cf, err;
+}
+
+/* read and check config only, with key=value overrides in set; datasets are not loaded */
+func LoadConfig(path string, set []string, debug bool) (*Config, error) {
   cf := &Config {
     conf: path,
+    set: set,
     debug: debug,
+    workers: &pool.WorkerPool{},
   };
-  err := cf.init_resource();
+  err := cf.init_config();
   return cf, err;
 }
 
 /* init functions */
-func (cf *Config) init_resource() (error) {
+func (cf *Config) init_resource(ctx context.Context) (error) {
   var err error;
   if err = cf.init_config(); err != nil {
     return err;
@@ -178,7 +281,7 @@ func (cf *Config) init_resource() (error) {
   if err = cf.init_buffers(); err != nil {
     return err;
   }
-  if err = cf.init_dataset(); err != nil {
+  if err = cf.init_dataset(ctx); err != nil {
     return err;
   }
   return nil;
@@ -186,31 +289,91 @@ func (cf *Config) init_resource() (error) {
 
 /* load config */
 func (cf *Config) init_config() (error) {
-  err := config.InitJSONConf((*cf).conf, cf);
+  err := cf.read_config();
   if err != nil {
     return err;
   }
   if (*cf).debug {
     log.Printf("[PPRL][init_config] config: %v\n", (*cf));
   }
+  /* all problems are reported at once, warnings only logged */
+  if err = check_problems(cf.validate()); err != nil {
+    return err;
+  }
+  if err = cf.init_value(); err != nil {
+    return err;
+  }
+  if err = cf.init_key(); err != nil {
+    return err;
+  }
+  /* malloc and set dataset */
+  (*cf).path = strings.Split((*cf).Dataset, ",");
+  /* records are counted while loading, size only reserves room */
+  sizes := make([]string, len((*cf).path));
+  if strings.TrimSpace((*cf).Size) != "" {
+    sizes = strings.Split((*cf).Size, ",");
+  }
+  if len(sizes) != len((*cf).path) {
+    return ErrConfigSizeNotMatch;
+  }
+  for i := 0; i < len((*cf).path); i++ {
+    size := 0;
+    if strings.TrimSpace(sizes[i]) != "" {
+      if size, err = strconv.Atoi(strings.TrimSpace(sizes[i])); err != nil || size < 0 {
+        return ErrSize;
+      }
+    }
+    cf.new_dataset(size);
+  }
+  return nil;
+}
+
+/*
+  read the config file, then PPRL_* environment variables, then key=value
+  overrides, each over the one before; all before validation
+*/
+func (cf *Config) read_config() (error) {
+  override := config.EnvOverrides(EnvPrefix, cf);
+  for _, s := range (*cf).set {
+    o, err := config.ParseOverride(s, "-set");
+    if err != nil {
+      return err;
+    }
+    override = append(override, o);
+  }
+  if (*cf).debug {
+    for _, o := range override {
+      log.Printf("[PPRL][init_config] %s overridden by %s\n", o.Key, o.Source);
+    }
+  }
+  return config.InitConfOverride((*cf).conf, cf, override);
+}
 
+/*
+  write exported fields as JSON, after init they hold the effective config
+  with defaults filled in; chunk stays 0 when batches are sized on each run
+*/
+func (cf *Config) WriteJSON(w io.Writer) (error) {
+  data, err := json.MarshalIndent(cf, "", "  ");
+  if err != nil {
+    return err;
+  }
+  _, err = w.Write(append(data, '\n'));
+  return err;
+}
+
+/* check values and fill up defaults, datasets are not touched */
+func (cf *Config) init_value() (error) {
+  var err error;
   /* value check */
   if (*cf).Buffer <= 0 {
-    (*cf).buffer_pool = _default_buffer_pool;
-  } else {
-    (*cf).buffer_pool = (*cf).Buffer;
+    (*cf).Buffer = _default_buffer_pool;
   }
+  (*cf).buffer_pool = (*cf).Buffer;
   if (*cf).Hash <= 0 {
-    (*cf).hash_pool = _default_hash_pool;
-  } else {
-    (*cf).hash_pool = (*cf).Hash;
-  }
-  (*cf).path = strings.Split((*cf).Dataset, ",");
-  (*cf).nd = len((*cf).path);
-  sizes := strings.Split((*cf).Size, ",");
-  if len(sizes) != (*cf).nd {
-    return ErrConfigSizeNotMatch;
+    (*cf).Hash = _default_hash_pool;
   }
+  (*cf).hash_pool = (*cf).Hash;
   if (*cf).Nf == nil || (*(*cf).Nf) == 0 {
     return ErrNf;
   }
@@ -231,7 +394,41 @@ func (cf *Config) init_config() (error) {
     ratio := _default_ratio
     (*cf).Ratio = &ratio;
   }
-  ignore := strings.Split((*cf).Ignore, ",");
+  if (*cf).MinK == 0 {
+    (*cf).MinK = _default_min_hash;
+  }
+  if (*cf).MaxK == 0 {
+    (*cf).MaxK = _default_max_hash;
+  }
+  if (*cf).BlockIter == 0 {
+    (*cf).BlockIter = _default_block_iter;
+  }
+  if (*cf).Threshold == nil {
+    threshold := _default_threshold;
+    (*cf).Threshold = &threshold;
+  }
+  if err = check_assign((*cf).Assign); err != nil {
+    return err;
+  }
+  if (*cf).Assign == "" {
+    (*cf).Assign = AssignNone;
+  }
+  if (*cf).AssignLimit <= 0 {
+    (*cf).AssignLimit = _default_assign_limit;
+  }
+  if err = check_seed((*cf).HashSeed); err != nil {
+    return err;
+  }
+  if (*cf).HashSeed == "" {
+    (*cf).HashSeed = _default_hash_seed;
+  }
+  if (*cf).IdField != nil && ((*(*cf).IdField) < 0 || (*(*cf).IdField) >= (*(*cf).Nf)) {
+    return ErrIdField;
+  }
+  ignore := []string{};
+  if strings.TrimSpace((*cf).Ignore) != "" {
+    ignore = strings.Split((*cf).Ignore, ",");
+  }
   if len(ignore) >= (*(*cf).Nf) {
     return ErrInvalidIgnore;
   }
@@ -244,66 +441,73 @@ func (cf *Config) init_config() (error) {
     }
     (*cf).ignore[tmp_ignore] = true;
   }
-  /* malloc and set dataset */
-  (*cf).fp = make([]*os.File, (*cf).nd);
-  (*cf).dataset = make([]*Dataset, (*cf).nd);
   (*cf).g = make([]float64, (*(*cf).Nf));
   (*cf).k = make([]int, (*(*cf).Nf));
   (*cf).m = make([]int, (*(*cf).Nf));
-  for i := 0; i < (*cf).nd; i++ {
-    size, err := strconv.Atoi(sizes[i]);
-    if err != nil {
-      return ErrSize;
-    }
-    (*cf).dataset[i] = &Dataset {
-      Discriminatory: make([]*float64, (*(*cf).Nf)),
-      Entropy: make([]*float64, (*(*cf).Nf)),
-      //Weight: make([]*float64, (*(*cf).Nf)),
-      Weight: &(*cf).weight,
-
-      record: make([]*Record, size),
-      nr: size,
-      nf: (*cf).Nf,
-      ignore: &((*cf).ignore),
-      debug: &(*cf).debug,
-    };
-  }
   (*cf).weight = make([]float64, (*(*cf).Nf));
   return nil;
 }
 
+/* append an empty dataset expecting size records, more or less are added as loaded */
+func (cf *Config) new_dataset(size int) (*Dataset) {
+  /* the hint is only trusted as far as a reasonable reservation */
+  reserve := size;
+  if reserve > _max_record_hint {
+    reserve = _max_record_hint;
+  }
+  d := &Dataset {
+    Discriminatory: make([]*float64, (*(*cf).Nf)),
+    Entropy: make([]*float64, (*(*cf).Nf)),
+    //Weight: make([]*float64, (*(*cf).Nf)),
+    Weight: &(*cf).weight,
+
+    record: make([]*Record, 0, reserve),
+    nf: (*cf).Nf,
+    ignore: &((*cf).ignore),
+    workers: (*cf).workers,
+    enc: &(*cf).enc,
+    progress: &(*cf).progress,
+    index: (*cf).nd,
+    size: size,
+    debug: &(*cf).debug,
+  };
+  (*cf).dataset = append((*cf).dataset, d);
+  (*cf).fp = append((*cf).fp, nil);
+  (*cf).nd++;
+  return d;
+}
+
 /* init buffers */
 func (cf *Config) init_buffers() (error) {
+  enc := &encoder{};
   /* initialize necessary buffers */
-  buffers = Buffers {
+  (*enc).buffers = Buffers {
     index: &pool.IndexPool{},
     buffer: make([]*Buffer, (*cf).buffer_pool),
   };
-  buffers.index.InitIndexPool((*cf).buffer_pool);
+  (*enc).buffers.index.InitIndexPool((*cf).buffer_pool);
   var tmp_str_ary []string;
   for i := 0; i < (*cf).buffer_pool; i++ {
     tmp_str_ary = make([]string, (*(*cf).Nf));
-    buffers.buffer[i] = &Buffer {
+    (*enc).buffers.buffer[i] = &Buffer {
       Index: i,
       field_buffer: tmp_str_ary,
+      pool: &(*enc).buffers,
     };
   }
-  /* initialize paddings */
-  padding_tbl = make([]string, _padding_tbl_size);
-  padding := "";
-  for i := 0; i < _padding_tbl_size; i++ {
-    padding_tbl[i] = padding;
-    padding += "*";
-  }
+  (*enc).seed = (*cf).HashSeed;
   /* initialize hashes */
-  hashes = Hashes {
+  (*enc).hashes = Hashes {
     index: &pool.IndexPool{},
     hash: make([]*Hash, (*cf).hash_pool),
   };
+  (*enc).hashes.index.InitIndexPool((*cf).hash_pool);
   for i := 0; i < (*cf).hash_pool; i++ {
-    hashes.hash[i] = &Hash {
+    (*enc).hashes.hash[i] = &Hash {
       Index: i,
-      hash: md5.New(),
+      hash: (*cf).key.new_hash(),
+      pool: &(*enc).hashes,
+      enc: enc,
     };
   }
   /* create basic bloom table */
@@ -311,7 +515,7 @@ func (cf *Config) init_buffers() (error) {
   for i := 0; i < 8; i++ {
     basic_bloom[i] = uint8(1) << uint8(i);
   }
-  bloom_table = make([][]byte, (*cf).Mb);
+  (*enc).bloom_table = make([][]byte, (*cf).Mb);
   bf_bytes := (*cf).Mb / 8;
   if (*cf).Mb % 8 != 0 {
     bf_bytes++;
@@ -319,69 +523,51 @@ func (cf *Config) init_buffers() (error) {
   slot_byte := 0;
   slot_basic := 0;
   for i := 0; i < (*cf).Mb; i++ {
-    bloom_table[i] = make([]byte, bf_bytes);
+    (*enc).bloom_table[i] = make([]byte, bf_bytes);
     slot_byte = i / 8;
     slot_basic = i % 8;
-    bloom_table[i][slot_byte] = basic_bloom[slot_basic];
-  }
-  /* create go_routine pool */
-  go_pool = go_pool_st {
-    index: &pool.IndexPool{},
-    pool: make([]*go_st, (*cf).MaxGo),
+    (*enc).bloom_table[i][slot_byte] = basic_bloom[slot_basic];
   }
-  go_pool.index.InitIndexPool((*cf).MaxGo);
-  for i := 0; i < (*cf).MaxGo; i++ {
-    go_pool.pool[i] = &go_st {
-      index: i,
-    };
+  (*cf).enc = enc;
+  /* create worker pool, no more workers than usable CPUs */
+  worker := runtime.GOMAXPROCS(0);
+  if (*cf).MaxGo < worker {
+    worker = (*cf).MaxGo;
   }
+  (*cf).workers.InitWorkerPool(worker, (*cf).Chunk);
   return nil;
 }
 
 /* get a buffer */
-func get_buffer() (*Buffer) {
-  index := buffers.index.GetIndex();
-  (*(buffers.buffer[index])).Index = index;
-  return buffers.buffer[index];
+func (e *encoder) get_buffer() (*Buffer) {
+  index := (*e).buffers.index.GetIndex();
+  (*((*e).buffers.buffer[index])).Index = index;
+  return (*e).buffers.buffer[index];
 }
 
 /* free a buffer */
 func (b *Buffer) free_buffer() {
   index := (*b).Index;
-  buffers.index.FreeIndex(index);
+  (*b).pool.index.FreeIndex(index);
   return;
 }
 
 /* get a hash */
-func get_hash() (*Hash) {
-  index := hashes.index.GetIndex();
-  (*(hashes.hash[index])).Index = index;
-  return hashes.hash[index];
+func (e *encoder) get_hash() (*Hash) {
+  index := (*e).hashes.index.GetIndex();
+  (*((*e).hashes.hash[index])).Index = index;
+  return (*e).hashes.hash[index];
 }
 
 /* free a buffer */
 func (h *Hash) free_hash() {
   index := (*h).Index;
-  hashes.index.FreeIndex(index);
-  return;
-}
-
-/* get a go routine */
-func get_go() (*go_st) {
-  index := go_pool.index.GetIndex();
-  (*go_pool.pool[index]).index = index;
-  return go_pool.pool[index];
-}
-
-/* free a go routine */
-func (g *go_st) free_go() {
-  index := (*g).index;
-  go_pool.index.FreeIndex(index);
+  (*h).pool.index.FreeIndex(index);
   return;
 }
 
 /* load datasets */
-func (cf *Config) init_dataset() (error) {
+func (cf *Config) init_dataset(ctx context.Context) (error) {
   var err error;
   /* open files */
   defer (*cf).finish();
@@ -391,18 +577,28 @@ func (cf *Config) init_dataset() (error) {
       return err;
     }
   }
-  return cf.load_datasets();
+  return cf.load_datasets(ctx);
 }
 
 /* load dataset from file */
-func (cf *Config) load_datasets() (error) {
+func (cf *Config) load_datasets(ctx context.Context) (error) {
   var wg sync.WaitGroup;
+  errs := make([]error, (*cf).nd);
   for i := 0; i < (*cf).nd; i++ {
     wg.Add(1);
-    go load_single_dataset(cf, i, &wg);
+    go load_single_dataset(ctx, cf, i, &wg, &errs[i]);
   }
   wg.Wait();
-  /* average len(n_gram) of each field of the datasets */
+  for _, err := range errs {
+    if err != nil {
+      return err;
+    }
+  }
+  return nil;
+}
+
+/* average len(n_gram) of each field of the datasets */
+func (cf *Config) average_ngram() {
   sum := make([]float64, (*(*cf).Nf));
   sum_nr := float64(0);
   var d *Dataset;
@@ -416,109 +612,150 @@ func (cf *Config) load_datasets() (error) {
   for i := 0; i < (*(*cf).Nf); i++ {
     (*cf).g[i] = math.Ceil(sum[i] / sum_nr);
   }
-  return nil;
 }
 
 /* load single dataset from file */
-func load_single_dataset(cf *Config, this int, wg *sync.WaitGroup) {
-  /* get a go routine */
-  go_routine := get_go();
-  /* preparing variables */
+func load_single_dataset(ctx context.Context, cf *Config, this int, wg *sync.WaitGroup, err *error) {
+  defer (*wg).Done();
+  (*err) = cf.load_reader(ctx, this, (*cf).fp[this]);
+}
+
+/* load a dataset from csv lines, the first line is the head line */
+func (cf *Config) load_reader(ctx context.Context, this int, r io.Reader) (error) {
   var raw_record string;
-  padding := "";
-  for i := 0; i < (*(*cf).Ng) - 1; i++ {
-    padding = padding + " ";
-  }
-  /* for each dataset, use go routine to initialize corresponding resources */
+  var err error;
   dataset := (*cf).dataset[this];
-  defer func() {
-    go_routine.free_go();
-    (*wg).Done();
-  } ();
-  scanner := bufio.NewScanner((*cf).fp[this]);
+  scanner := bufio.NewScanner(r);
   if (*cf).debug {
     log.Printf("[PPRL][load_datasets] scanner: %v\n", scanner);
   }
   cnt := 0;
-  dummy_nf := 0;    // dummy value for tstrings.Split
+  nf := 0;
   var buffer *Buffer;
+  /* total is the expected size, unknown if 0 */
+  progress := new_progress((*cf).progress, StageLoad, this, int64((*dataset).size));
   for scanner.Scan() {
-    buffer = get_buffer();
+    if cnt % _cancel_check == 0 {
+      if err = ctx.Err(); err != nil {
+        return err;
+      }
+    }
+    buffer = (*cf).enc.get_buffer();
     raw_record = scanner.Text();
     ///*
     if (*cf).debug {
       log.Printf("[PPRL][load_datasets] %d/%d: %s\n", this, cnt, raw_record);
     }
     //*/
-    tstrings.Split(raw_record, ",", &(*buffer).field_buffer, &dummy_nf);
-    if cnt == 0 {
-      /* memory allocation */
-      (*dataset).field = make([]*FieldMeta, (*(*cf).Nf));
-      (*dataset).record = make([]*Record, (*dataset).nr);
-      (*dataset).g = make([]float64, (*(*cf).Nf));
-      for i := 0; i < (*(*cf).Nf); i++ {
-        /* head line, initialize FieldMeta */
-        (*dataset).field[i] = &FieldMeta {
-          name: strings.TrimSpace((*buffer).field_buffer[i]),
-          index: i,
-          freq: make(map[string]float64),
-          exists: 0,
-          total: 0,
-          discriminatory: 0,
-          entropy: 0,
-          weight: &((*cf).weight[i]),
-          avg_n_gram: &(*dataset).g[i],
-        };
-
-        /* link discriminatory/entropy array in Dataset to FieldMeta */
-        (*dataset).Discriminatory[i] = &((*(*dataset).field[i]).discriminatory);
-        (*dataset).Entropy[i] = &((*(*dataset).field[i]).entropy);
+    tstrings.Split(raw_record, ",", &(*buffer).field_buffer, &nf);
+    /* missing trailing fields are empty, not left over from the previous line */
+    for i := nf; i < (*(*cf).Nf); i++ {
+      (*buffer).field_buffer[i] = "";
+    }
+    err = cf.add_row(dataset, cnt, (*buffer).field_buffer);
+    buffer.free_buffer();
+    if err != nil {
+      return err;
+    }
+    if cnt > 0 {
+      progress.add(1);
+    }
+    cnt++;
+  }
+  if err = scanner.Err(); err != nil {
+    return err;
+  }
+  cf.finish_dataset(dataset, cnt);
+  return nil;
+}
 
-      }
-      /* allocate Record */
-      (*dataset).record = make([]*Record, (*dataset).nr);
-    } else {
-      /* record lines, fillup Record */
-      record := Record {
-        field: make([]*Field, (*(*cf).Nf)),
-        bloom_filter: make([]byte, (*cf).Mb),
-        block: make([]int, 1 << uint32((*cf).Blk)),
+/* add the cnt-th row of a dataset, row 0 is the head line */
+func (cf *Config) add_row(dataset *Dataset, cnt int, row []string) (error) {
+  padding := "";
+  for i := 0; i < (*(*cf).Ng) - 1; i++ {
+    padding = padding + " ";
+  }
+  if cnt == 0 {
+    /* memory allocation */
+    (*dataset).field = make([]*FieldMeta, (*(*cf).Nf));
+    (*dataset).g = make([]float64, (*(*cf).Nf));
+    for i := 0; i < (*(*cf).Nf); i++ {
+      /* head line, initialize FieldMeta */
+      (*dataset).field[i] = &FieldMeta {
+        name: strings.TrimSpace(row[i]),
+        index: i,
+        freq: make(map[string]float64),
+        exists: 0,
+        total: 0,
+        discriminatory: 0,
+        entropy: 0,
+        weight: &((*cf).weight[i]),
+        avg_n_gram: &(*dataset).g[i],
       };
-      (*dataset).record[cnt - 1] = &record;
-      for i := 0; i < (*(*cf).Nf); i++ {
-        (*(*dataset).field[i]).total++;
-        raw := strings.TrimSpace((*buffer).field_buffer[i]);
-        padded := raw;
-        if raw != "" {
-          padded = padding + padded + padding;
-          (*(*dataset).field[i]).exists++;
-          (*(*dataset).field[i]).sum_n_gram += float64(len(padded) - (*(*cf).Ng) + 1);
-        } else {
-          raw = "n/a";
-          padded = " " + padding;
-        }
-        record.field[i] = &Field {
-          raw: raw,
-          padded: padded,
-          ng: (*cf).Ng,
-          mb: &(*cf).Mb,
-          //bf_index has to be decided once k and n_gram are calculated
-        };
-      }
+
+      /* link discriminatory/entropy array in Dataset to FieldMeta */
+      (*dataset).Discriminatory[i] = &((*(*dataset).field[i]).discriminatory);
+      (*dataset).Entropy[i] = &((*(*dataset).field[i]).entropy);
+
     }
-    cnt++;
-    buffer.free_buffer();
+    return nil;
   }
+  /* record lines, fillup Record; rows come in order, so the record of line cnt + 1 is appended */
+  bf_bytes := (*cf).Mb / 8;
+  if (*cf).Mb % 8 != 0 {
+    bf_bytes++;
+  }
+  record := Record {
+    id: strconv.Itoa(cnt + 1),
+    line: cnt + 1,
+    field: make([]*Field, (*(*cf).Nf)),
+    bloom_filter: make([]byte, bf_bytes),
+  };
+  if (*cf).IdField != nil {
+    record.id = strings.TrimSpace(row[(*(*cf).IdField)]);
+  }
+  (*dataset).record = append((*dataset).record, &record);
+  for i := 0; i < (*(*cf).Nf); i++ {
+    (*(*dataset).field[i]).total++;
+    raw := strings.TrimSpace(row[i]);
+    padded := raw;
+    if raw != "" {
+      padded = padding + padded + padding;
+      (*(*dataset).field[i]).exists++;
+      (*(*dataset).field[i]).sum_n_gram += float64(len(padded) - (*(*cf).Ng) + 1);
+    } else {
+      raw = "n/a";
+      padded = " " + padding;
+    }
+    record.field[i] = &Field {
+      raw: raw,
+      padded: padded,
+      ng: (*cf).Ng,
+      mb: &(*cf).Mb,
+      //bf_index has to be decided once k and n_gram are calculated
+    };
+  }
+  return nil;
+}
+
+/* field averages once all cnt rows (head line included) are added */
+func (cf *Config) finish_dataset(dataset *Dataset, cnt int) {
   var f *FieldMeta;
+  if cnt == 0 {
+    /* not even a head line */
+    cf.add_row(dataset, 0, make([]string, (*(*cf).Nf)));
+    cnt = 1;
+  }
   for i := 0; i < (*(*cf).Nf); i++ {
     f = (*dataset).field[i];
     if !(*cf).ignore[i] {
       (*(*f).avg_n_gram) = math.Ceil((*f).sum_n_gram / (*f).exists);
     }
   }
-  if cnt - 1 != (*dataset).nr {
-    log.Printf("[PPRL][InitConfig] #record in config is %d, differ from dataset file (%d)\n", (*dataset).nr, cnt - 1);
+  if (*cf).debug && (*dataset).size > 0 && cnt - 1 != (*dataset).size {
+    log.Printf("[PPRL][InitConfig] size hint of dataset %d is %d, dataset file has %d records\n", (*dataset).index, (*dataset).size, cnt - 1);
   }
+  (*dataset).nr = len((*dataset).record);
 }
 
 /* close file pointers in Config */
@@ -0,0 +1,112 @@
+package pprl;
+
+import "bufio";
+import "context";
+import "fmt";
+import "io";
+import "sync/atomic";
+
+/* duplicates within a set */
+type DedupResult struct {
+  Cluster []int;                // cluster of each filter, numbered by first record
+  Match []*Match;               // duplicate pairs, LineA < LineB, ordered by (LineA, LineB)
+  Candidate int64;              // #distinct pair compared after blocking
+  Clusters int;                 // #cluster, singletons included
+  Duplicate int;                // #record in a cluster of at least 2 records
+}
+
+/* find duplicates in a dataset of config */
+func (cf *Config) Dedup(ctx context.Context, i int) (*DedupResult, error) {
+  if i < 0 || i >= (*cf).nd {
+    return nil, ErrDatasetIndex;
+  }
+  return Dedup(ctx, cf.Filters(i), cf.compare_option());
+}
+
+/*
+  compare a set with itself and join records scoring above threshold;
+  clusters are connected components, so duplicates chain transitively
+*/
+func Dedup(ctx context.Context, filters []*Filter, opt *CompareOption) (*DedupResult, error) {
+  result := &DedupResult{};
+  /* duplicates of record i among later records, each i only touched by one worker */
+  found := make([][]int, len(filters));
+  score := make([][]float64, len(filters));
+  var candidate int64;
+  /* each pair is seen from both sides, only (i, j > i) is kept */
+  _, err := scan_candidates(ctx, filters, filters, opt, func(i, j int, s float64) {
+    if j <= i {
+      return;
+    }
+    atomic.AddInt64(&candidate, 1);
+    if s >= (*opt).Threshold {
+      found[i] = append(found[i], j);
+      score[i] = append(score[i], s);
+    }
+  });
+  if err != nil {
+    return nil, err;
+  }
+  (*result).Candidate = candidate;
+  parent := make([]int, len(filters));
+  for i := range parent {
+    parent[i] = i;
+  }
+  find := func(i int) (int) {
+    for parent[i] != i {
+      parent[i] = parent[parent[i]];
+      i = parent[i];
+    }
+    return i;
+  };
+  for i, js := range found {
+    for k, j := range js {
+      (*result).Match = append((*result).Match, &Match {
+        IdA: (*filters[i]).Id,
+        IdB: (*filters[j]).Id,
+        LineA: (*filters[i]).Line,
+        LineB: (*filters[j]).Line,
+        Score: score[i][k],
+      });
+      ri, rj := find(i), find(j);
+      /* the smaller index stays root, so cluster ids follow the first record */
+      if ri < rj {
+        parent[rj] = ri;
+      } else if rj < ri {
+        parent[ri] = rj;
+      }
+    }
+  }
+  sort_matches((*result).Match);
+  (*result).Cluster = make([]int, len(filters));
+  id := make(map[int]int);
+  size := make(map[int]int);
+  for i := range filters {
+    root := find(i);
+    c, ok := id[root];
+    if !ok {
+      c = len(id);
+      id[root] = c;
+    }
+    (*result).Cluster[i] = c;
+    size[c]++;
+  }
+  (*result).Clusters = len(id);
+  for _, n := range size {
+    if n > 1 {
+      (*result).Duplicate += n;
+    }
+  }
+  return result, nil;
+}
+
+/* write one "id,line,cluster" line per filter */
+func WriteDedup(w io.Writer, filters []*Filter, cluster []int) (error) {
+  bw := bufio.NewWriter(w);
+  for i, f := range filters {
+    if _, err := fmt.Fprintf(bw, "%s,%d,%d\n", escape_id((*f).Id), (*f).Line, cluster[i]); err != nil {
+      return err;
+    }
+  }
+  return bw.Flush();
+}
@@ -1,129 +1,83 @@
 package pprl;
 
+import "context";
 import "crypto/md5";
 import "io";
-import "math";
-import "sync";
+import "log";
 
 import "util/tannhauser/numbers";
 
 /* distribute bloom filter bits to each field and calculate parameters for encoding */
 func (cf *Config) prepare_encoding() (error) {
-  /* first distribution */
-  sum := 0;
-  for i := 0; i < (*(*cf).Nf); i++ {
-    (*cf).m[i] = int(math.Floor(float64((*cf).Mb) * (*cf).weight[i]));
-    sum += (*cf).m[i];
-  }
-  /* distribute remaining */
-  dif := (*cf).Mb - sum;
-  if dif < 0 {
-    return ErrMb;
+  if err := cf.plan_encoding(); err != nil {
+    return err;
   }
-  dispatched := 0;
-  if dif > 0 {
-    distributed := make([]bool, (*(*cf).Nf));
-    min := 0;
-    index := 0;
-    for i := 0; i < dif; i++ {
-      min = 0;
-      for j := 0; j < (*(*cf).Nf); j++ {
-        if !(*cf).ignore[j] {
-          if min == 0 || (*cf).m[i] < min && !distributed[i] {
-            min = (*cf).m[i];
-            index = i;
-          }
-        }
-      }
-      (*cf).m[index]++;
-      distributed[index] = true;
-      dispatched++;
-      if dispatched % (*(*cf).Nf) == 0 {
-        for j := 0; j < (*(*cf).Nf); j++ {
-          distributed[j] = false;
-        }
-      }
+  for _, f := range (*(*cf).plan).Field {
+    if (*f).Clamped {
+      log.Printf("[PPRL][prepare_encoding] k of field %d (%s) is %f, clamped to %d\n", (*f).Index, (*f).Name, (*f).RawK, (*f).K);
     }
-  }
-  /* check sum of #bit */
-  sum = 0;
-  for i := 0; i < (*(*cf).Nf); i++ {
-    sum += (*cf).m[i];
-  }
-  dif = (*cf).Mb - sum;
-  if dif != 0 {
-    return ErrMbDistribution;
-  }
-
-  /* calculate k_i */
-  p := math.Log2(*(*cf).Ratio);
-  m := float64(0);
-  for i := 0; i < (*(*cf).Nf); i++ {
-    if !(*cf).ignore[i] {
-      m = (float64((*cf).m[i]) - 1)/float64((*cf).m[i]);
-      num_hash := (p/math.Log2(m))/(*cf).g[i];
-      (*cf).k[i] = int(num_hash);
-      /* allocate bf_index for each field of each record */
-      for j := 0; j < (*cf).nd; j++ {
-        d := (*cf).dataset[j];
-        for k := 0; k < (*d).nr; k++ {
-          f := (*(*d).record[k]).field[i];
-          (*f).bf_index = make([][]int, (*cf).k[i]);
-          for l := 0; l < (*cf).k[i]; l++ {
-            (*f).bf_index[l] = make([]int, len((*f).ngram));
-          }
-        }
-      }
+    if (*cf).debug && !(*f).Ignored {
+      log.Printf("[PPRL][prepare_encoding] field %d (%s): m=%d, k=%d, fill=%f, fpr=%e\n", (*f).Index, (*f).Name, (*f).M, (*f).K, (*f).Fill, (*f).FPR);
     }
   }
-
   return nil;
 }
 
 /* set bloom filters */
-func (cf *Config) set_bloom_filter() (error) {
-  if err := cf.set_bloom_index(); err != nil {
+func (cf *Config) set_bloom_filter(ctx context.Context) (error) {
+  if err := cf.set_bloom_index(ctx); err != nil {
     return err;
   }
+  for _, d := range (*cf).dataset {
+    if err := d.encoding(ctx); err != nil {
+      return err;
+    }
+  }
   return nil;
 }
 
 /* set bloom table index */
-func (cf *Config) set_bloom_index() (error) {
-  /* use go routine for parallel processing */
-  wg := sync.WaitGroup{};
-  /* get bloom filter indexes */
+func (cf *Config) set_bloom_index(ctx context.Context) (error) {
+  /* get bloom filter indexes, a batch of records per worker */
   for i := 0; i < (*cf).nd; i++ {
     d := (*cf).dataset[i];
-    for j := 0; j < (*d).nr; j++ {
-      record := (*d).record[j];
-      for k := 0; k < (*(*d).nf); k++ {
-        f := (*record).field[k];
-        wg.Add(1);
-        go f.get_bloom_index(&(*cf).k[k], &wg);
+    progress := new_progress((*cf).progress, StageIndex, i, int64((*d).nr));
+    err := (*cf).workers.RunContext(ctx, (*d).nr, func(start, end int) {
+      /* one hash instance for the whole batch */
+      h := (*cf).enc.get_hash();
+      defer h.free_hash();
+      for _, record := range (*d).record[start:end] {
+        for k := 0; k < (*(*d).nf); k++ {
+          (*record).field[k].get_bloom_index(h, &(*cf).k[k]);
+        }
       }
+      progress.add(int64(end - start));
+    });
+    if err != nil {
+      return err;
     }
   }
-  wg.Wait();
   return nil;
 }
 
 /* get bloom table index for specific field of certain record */
-func (f *Field) get_bloom_index(method *int, wg *sync.WaitGroup) {
+func (f *Field) get_bloom_index(h *Hash, method *int) {
+  /* bf_index is sized here, once k and n-gram are both decided */
+  (*f).bf_index = make([][]int, (*method));
+  for j := 0; j < (*method); j++ {
+    (*f).bf_index[j] = make([]int, len((*f).ngram));
+  }
   for i := 0; i < len((*f).ngram); i++ {
     for j := 0; j < (*method); j++ {
-      get_index(&(*f).ngram[i], &(*f).bf_index[j][i], &j, (*f).mb);
+      h.get_index(&(*f).ngram[i], &(*f).bf_index[j][i], &j, (*f).mb);
     }
   }
-  (*wg).Done();
   return;
 }
 
 /* get bloom table index from the given input string pointer */
-func get_index(in *string, out *int, method *int, mb *int) {
-  h := get_hash()
+func (h *Hash) get_index(in *string, out *int, method *int, mb *int) {
   hash_value := h.get_hash_value(in, method);
-  h.free_hash();
   hash_to_index(out, mb, &hash_value);
 }
 
@@ -138,61 +92,46 @@ func hash_to_index(out, mb *int, value *[]byte) {
 /* get hash value from input string pointer and specified hash method */
 func (h *Hash) get_hash_value(in *string, method *int) ([]byte) {
   (*h).hash.Reset();
-  hash_input := get_padding(in, method);
-  io.WriteString((*h).hash, (*hash_input));
-  return (*h).hash.Sum(nil);
+  h.write_seed(*method);
+  io.WriteString((*h).hash, (*in));
+  (*h).sum = (*h).hash.Sum((*h).sum[:0]);
+  return (*h).sum;
 }
 
-/* get string padding for specified hash method */
-func get_padding(in *string, method *int) (*string) {
-  remain := (*method);
-  padding := "";
-  /* use _padding_tbl_size = 11 */
-  for {
-    if remain >= 10 {
-      padding += padding_tbl[10];
-      remain -= 10;
-    }
-    if remain >= 9 {
-      padding += padding_tbl[9];
-      remain -= 9;
-    }
-    if remain >= 8 {
-      padding += padding_tbl[8];
-      remain -= 8;
-    }
-    if remain >= 7 {
-      padding += padding_tbl[7];
-      remain -= 7;
-    }
-    if remain >= 6 {
-      padding += padding_tbl[6];
-      remain -= 6;
-    }
-    if remain >= 5 {
-      padding += padding_tbl[5];
-      remain -= 5;
-    }
-    if remain >= 4 {
-      padding += padding_tbl[4];
-      remain -= 4;
-    }
-    if remain >= 3 {
-      padding += padding_tbl[3];
-      remain -= 3;
-    }
-    if remain >= 2 {
-      padding += padding_tbl[2];
-      remain -= 2;
-    }
-    if remain >= 1 {
-      padding += padding_tbl[1];
-      remain -= 1;
-    }
-    if remain == 0 {
-      padded := padding + (*in);
-      return &padded;
+/*
+  seed the hash for hash method i: with SeedPrefix i goes first as 4 little
+  endian bytes; with SeedPadding i "*" go first, as in the original padded
+  md5, written a slice of the padding at a time so that any k works
+*/
+func (h *Hash) write_seed(i int) {
+  if (*(*h).enc).seed == SeedPadding {
+    for i > 0 {
+      n := i;
+      if n > len(_padding) {
+        n = len(_padding);
+      }
+      io.WriteString((*h).hash, _padding[:n]);
+      i -= n;
     }
+    return;
+  }
+  numbers.PutUi32L((*h).prefix[:], uint32(i));
+  (*h).hash.Write((*h).prefix[:]);
+}
+
+/* seeding of the hash in encoded metadata, empty for SeedPadding as before it was recorded */
+func meta_seed(seed string) (string) {
+  if seed == SeedPadding {
+    return "";
   }
+  return seed;
 }
 
+/* check the seeding of the hash methods */
+func check_seed(seed string) (error) {
+  switch seed {
+  case "", SeedPrefix, SeedPadding:
+    return nil;
+  }
+  return ErrHashSeed;
+}
@@ -0,0 +1,220 @@
+package pprl;
+
+import "context";
+import "fmt";
+import "io";
+import "sort";
+import "sync/atomic";
+
+/* linkage quality against ground truth */
+type Evaluation struct {
+  Threshold float64 `json:"threshold"`;      // threshold of the matches, 0 if unknown
+  Match int `json:"match"`;                  // #match reported
+  TruePositive int `json:"tp"`;              // #match of the same entity
+  FalsePositive int `json:"fp"`;             // #match of different entities
+  FalseNegative int `json:"fn"`;             // #pair of the same entity not matched
+  Precision float64 `json:"precision"`;      // tp / (tp + fp)
+  Recall float64 `json:"recall"`;            // tp / (tp + fn)
+  FMeasure float64 `json:"f_measure"`;       // harmonic mean of precision and recall
+
+  /* blocking quality, only when candidates are known */
+  Pairs int64 `json:"pairs"`;               // #pair without blocking, |A| * |B|
+  Candidate int64 `json:"candidate"`;       // #pair compared after blocking
+  TrueCandidate int64 `json:"true_candidate"`; // #candidate of the same entity
+  PairsCompleteness float64 `json:"pairs_completeness"`; // true candidates / true pairs
+  ReductionRatio float64 `json:"reduction_ratio"`; // 1 - candidates / pairs
+  Curve []*Evaluation `json:"curve,omitempty"`; // evaluation at each threshold
+}
+
+/* thresholds of precision-recall curves by default */
+var _default_curve = []float64{0.5, 0.55, 0.6, 0.65, 0.7, 0.75, 0.8, 0.85, 0.9, 0.95, 1};
+
+/* ground truth of a dataset, entity of each line taken from a field; missing values are left out */
+func (cf *Config) Truth(i, field int) (map[int]string, error) {
+  if i < 0 || i >= (*cf).nd {
+    return nil, ErrDatasetIndex;
+  }
+  if field < 0 || field >= (*(*cf).Nf) {
+    return nil, ErrFieldIndex;
+  }
+  truth := make(map[int]string);
+  for _, r := range (*(*cf).dataset[i]).record {
+    if r == nil {
+      continue;
+    }
+    raw := (*(*r).field[field]).raw;
+    if raw != "n/a" {
+      truth[(*r).line] = raw;
+    }
+  }
+  return truth, nil;
+}
+
+/* evaluate matches between two datasets, truth maps line number to entity */
+func Evaluate(matches []*Match, truth_a, truth_b map[int]string) (*Evaluation) {
+  e := &Evaluation {
+    Match: len(matches),
+  };
+  for _, m := range matches {
+    a, ok_a := truth_a[(*m).LineA];
+    b, ok_b := truth_b[(*m).LineB];
+    if ok_a && ok_b && a == b {
+      (*e).TruePositive++;
+    } else {
+      (*e).FalsePositive++;
+    }
+  }
+  (*e).FalseNegative = true_pairs(truth_a, truth_b) - (*e).TruePositive;
+  e.summarize();
+  return e;
+}
+
+/* precision-recall curve of matches at each threshold, only matches scoring at least the threshold are counted */
+func EvaluateCurve(matches []*Match, truth_a, truth_b map[int]string, thresholds []float64) ([]*Evaluation) {
+  curve := append([]float64{}, thresholds...);
+  sort.Float64s(curve);
+  var result []*Evaluation;
+  for _, t := range curve {
+    var above []*Match;
+    for _, m := range matches {
+      if (*m).Score >= t {
+        above = append(above, m);
+      }
+    }
+    e := Evaluate(above, truth_a, truth_b);
+    (*e).Threshold = t;
+    result = append(result, e);
+  }
+  return result;
+}
+
+/* evaluate blocking and matching of two sets of filters, with a precision-recall curve over thresholds (nil for default) */
+func EvaluateCompare(ctx context.Context, a, b []*Filter, opt *CompareOption, truth_a, truth_b map[int]string, thresholds []float64) (*Evaluation, error) {
+  if thresholds == nil {
+    thresholds = _default_curve;
+  }
+  curve := append([]float64{}, thresholds...);
+  sort.Float64s(curve);
+  th := append([]float64{}, thresholds...);
+  th = append(th, (*opt).Threshold);
+  sort.Float64s(th);
+  /* hist[k] counts candidates with th[k] <= score < th[k + 1] */
+  true_hist := make([]int64, len(th));
+  false_hist := make([]int64, len(th));
+  var true_candidate int64;
+  candidate, err := scan_candidates(ctx, a, b, opt, func(i, j int, score float64) {
+    ea, ok_a := truth_a[(*a[i]).Line];
+    eb, ok_b := truth_b[(*b[j]).Line];
+    same := ok_a && ok_b && ea == eb;
+    if same {
+      atomic.AddInt64(&true_candidate, 1);
+    }
+    n := sort.Search(len(th), func(k int) (bool) {
+      return th[k] > score;
+    });
+    if n == 0 {
+      return;
+    }
+    if same {
+      atomic.AddInt64(&true_hist[n - 1], 1);
+    } else {
+      atomic.AddInt64(&false_hist[n - 1], 1);
+    }
+  });
+  if err != nil {
+    return nil, err;
+  }
+  total := true_pairs(truth_a, truth_b);
+  /* cumulate from the highest threshold */
+  var tp, fp int64;
+  at := make(map[float64]*Evaluation);
+  for k := len(th) - 1; k >= 0; k-- {
+    tp += true_hist[k];
+    fp += false_hist[k];
+    e := &Evaluation {
+      Threshold: th[k],
+      Match: int(tp + fp),
+      TruePositive: int(tp),
+      FalsePositive: int(fp),
+      FalseNegative: total - int(tp),
+    };
+    e.summarize();
+    at[th[k]] = e;
+  }
+  result := *at[(*opt).Threshold];
+  result.Pairs = int64(len(a)) * int64(len(b));
+  result.Candidate = candidate;
+  result.TrueCandidate = true_candidate;
+  if total > 0 {
+    result.PairsCompleteness = float64(true_candidate) / float64(total);
+  }
+  if result.Pairs > 0 {
+    result.ReductionRatio = 1 - float64(candidate) / float64(result.Pairs);
+  }
+  for _, t := range curve {
+    result.Curve = append(result.Curve, at[t]);
+  }
+  return &result, nil;
+}
+
+/* evaluate blocking and matching of two datasets with ground truth from a field */
+func (cf *Config) Evaluate(ctx context.Context, a, b, field int, thresholds []float64) (*Evaluation, error) {
+  if a < 0 || a >= (*cf).nd || b < 0 || b >= (*cf).nd {
+    return nil, ErrDatasetIndex;
+  }
+  truth_a, err := cf.Truth(a, field);
+  if err != nil {
+    return nil, err;
+  }
+  truth_b, err := cf.Truth(b, field);
+  if err != nil {
+    return nil, err;
+  }
+  return EvaluateCompare(ctx, cf.Filters(a), cf.Filters(b), cf.compare_option(), truth_a, truth_b, thresholds);
+}
+
+/* #pair of the same entity across two datasets */
+func true_pairs(truth_a, truth_b map[int]string) (int) {
+  cnt := make(map[string]int);
+  for _, v := range truth_b {
+    cnt[v]++;
+  }
+  total := 0;
+  for _, v := range truth_a {
+    total += cnt[v];
+  }
+  return total;
+}
+
+/* precision, recall and f-measure from counts */
+func (e *Evaluation) summarize() {
+  if (*e).TruePositive + (*e).FalsePositive > 0 {
+    (*e).Precision = float64((*e).TruePositive) / float64((*e).TruePositive + (*e).FalsePositive);
+  }
+  if (*e).TruePositive + (*e).FalseNegative > 0 {
+    (*e).Recall = float64((*e).TruePositive) / float64((*e).TruePositive + (*e).FalseNegative);
+  }
+  if (*e).Precision + (*e).Recall > 0 {
+    (*e).FMeasure = 2 * (*e).Precision * (*e).Recall / ((*e).Precision + (*e).Recall);
+  }
+}
+
+/* display evaluation */
+func (e *Evaluation) Print(w io.Writer) {
+  if (*e).Threshold > 0 {
+    fmt.Fprintf(w, "threshold: %f\n", (*e).Threshold);
+  }
+  fmt.Fprintf(w, "matches: %d, tp: %d, fp: %d, fn: %d\n", (*e).Match, (*e).TruePositive, (*e).FalsePositive, (*e).FalseNegative);
+  fmt.Fprintf(w, "precision: %f, recall: %f, f-measure: %f\n", (*e).Precision, (*e).Recall, (*e).FMeasure);
+  if (*e).Pairs > 0 {
+    fmt.Fprintf(w, "pairs: %d, candidates: %d, true candidates: %d\n", (*e).Pairs, (*e).Candidate, (*e).TrueCandidate);
+    fmt.Fprintf(w, "pairs completeness: %f, reduction ratio: %f\n", (*e).PairsCompleteness, (*e).ReductionRatio);
+  }
+  if len((*e).Curve) == 0 {
+    return;
+  }
+  fmt.Fprintf(w, "%9s %8s %8s %8s %10s %8s %9s\n", "threshold", "matches", "tp", "fp", "precision", "recall", "f-measure");
+  for _, c := range (*e).Curve {
+    fmt.Fprintf(w, "%9.4f %8d %8d %8d %10.6f %8.6f %9.6f\n", (*c).Threshold, (*c).Match, (*c).TruePositive, (*c).FalsePositive, (*c).Precision, (*c).Recall, (*c).FMeasure);
+  }
+}
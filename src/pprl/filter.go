@@ -0,0 +1,260 @@
+package pprl;
+
+import "bufio";
+import "encoding/base64";
+import "encoding/json";
+import "fmt";
+import "io";
+import "strconv";
+import "strings";
+
+/* encoded record, the only thing leaving the data custodian */
+type Filter struct {
+  Id string;                    // source identifier
+  Line int;                     // line number in source file, head line is line 1
+  Bits []byte;                  // bloom filter
+}
+
+/* metadata of a set of encoded records */
+type Meta struct {
+  Mb int `json:"bloom_bit"`;     // #bit in the bloom filter
+  Ngram int `json:"ngram"`;      // n for n-gram
+  K []int `json:"hash"`;        // #hash for each field
+  Field []string `json:"field"`; // field names
+  Count int `json:"count"`;      // #record
+  Block *BlockMeta `json:"block,omitempty"`; // blocking of an index, see Index
+  Hardening string `json:"hardening,omitempty"`; // hardening applied to the filters, HardeningNone if unhardened
+  KeyId string `json:"key_id,omitempty"`; // key of keyed hashing, empty for unkeyed
+  Seed string `json:"hash_seed,omitempty"`; // seeding of the hash methods, empty for padding
+}
+
+/* blocking parameters kept with an index, so that inserted records land in the same blocks */
+type BlockMeta struct {
+  Bit int `json:"block_bit"`;   // #bit sampled for a block key
+  Iter int `json:"block_iter"`;  // #blocking iteration
+  Seed int64 `json:"block_seed"`; // seed for sampling block bits
+}
+
+/* prefix of the metadata line in encoded output */
+const _meta_prefix = "#";
+
+/* longest line accepted when reading encoded output */
+const _max_line = 16 * 1024 * 1024;
+
+/* most records reserved up front from the count in metadata, more are appended as read */
+const _max_filter_hint = 1 << 20;
+
+/* filters as encoded, no hardening applied afterwards */
+const HardeningNone = "none";
+
+/* hardening applied to the filters, HardeningNone if not recorded */
+func (m *Meta) AppliedHardening() (string) {
+  if (*m).Hardening == "" {
+    return HardeningNone;
+  }
+  return (*m).Hardening;
+}
+
+/* seeding of the hash methods of the filters, SeedPadding if not recorded */
+func (m *Meta) HashSeed() (string) {
+  if (*m).Seed == "" {
+    return SeedPadding;
+  }
+  return (*m).Seed;
+}
+
+/* #dataset */
+func (cf *Config) NumDataset() (int) {
+  return (*cf).nd;
+}
+
+/* collect filters of a dataset, in source order */
+func (cf *Config) Filters(i int) ([]*Filter) {
+  d := (*cf).dataset[i];
+  filters := make([]*Filter, 0, (*d).nr);
+  for _, r := range (*d).record {
+    if r == nil {
+      continue;
+    }
+    filters = append(filters, &Filter {
+      Id: (*r).id,
+      Line: (*r).line,
+      Bits: (*r).bloom_filter,
+    });
+  }
+  return filters;
+}
+
+/* metadata for filters of a dataset */
+func (cf *Config) Meta(i int) (*Meta) {
+  m := &Meta {
+    Mb: (*cf).Mb,
+    Ngram: (*(*cf).Ng),
+    K: make([]int, (*(*cf).Nf)),
+    Field: make([]string, (*(*cf).Nf)),
+    Count: len(cf.Filters(i)),
+    Hardening: HardeningNone,
+    KeyId: (*cf).key.id(),
+    Seed: meta_seed((*cf).HashSeed),
+  };
+  copy((*m).K, (*cf).k);
+  for j := 0; j < (*(*cf).Nf); j++ {
+    (*m).Field[j] = cf.field_name(j);
+  }
+  return m;
+}
+
+/* write metadata line and one "id,line,base64" line per filter */
+func WriteFilters(w io.Writer, meta *Meta, filters []*Filter) (error) {
+  bw := bufio.NewWriter(w);
+  if err := write_meta(bw, meta); err != nil {
+    return err;
+  }
+  for _, f := range filters {
+    if err := write_filter(bw, f); err != nil {
+      return err;
+    }
+  }
+  return bw.Flush();
+}
+
+/* metadata line of encoded output */
+func write_meta(w io.Writer, meta *Meta) (error) {
+  header, err := json.Marshal(meta);
+  if err != nil {
+    return err;
+  }
+  _, err = fmt.Fprintf(w, "%s%s\n", _meta_prefix, header);
+  return err;
+}
+
+/* "id,line,base64" line of a filter */
+func write_filter(w io.Writer, f *Filter) (error) {
+  _, err := fmt.Fprintf(w, "%s,%d,%s\n", escape_id((*f).Id), (*f).Line, base64.StdEncoding.EncodeToString((*f).Bits));
+  return err;
+}
+
+/* records read one at a time, Next returns io.EOF after the last */
+type FilterSource interface {
+  Next() (*Filter, error);
+}
+
+/* text encoded output read record by record, see WriteFilters */
+type FilterReader struct {
+  Meta *Meta;                   // metadata line
+  scanner *bufio.Scanner;
+  row int;                      // #byte per bloom filter
+  count int;                    // #record read
+}
+
+/* read filters written by WriteFilters */
+func ReadFilters(r io.Reader) (*Meta, []*Filter, error) {
+  fr, err := NewFilterReader(r);
+  if err != nil {
+    return nil, nil, err;
+  }
+  /* count is only trusted as far as a reasonable reservation */
+  hint := (*(*fr).Meta).Count;
+  if hint > _max_filter_hint {
+    hint = _max_filter_hint;
+  }
+  filters := make([]*Filter, 0, hint);
+  for {
+    f, err := fr.Next();
+    if err == io.EOF {
+      return (*fr).Meta, filters, nil;
+    }
+    if err != nil {
+      return nil, nil, err;
+    }
+    filters = append(filters, f);
+  }
+}
+
+/* read the metadata line, records follow with Next */
+func NewFilterReader(r io.Reader) (*FilterReader, error) {
+  scanner := bufio.NewScanner(r);
+  scanner.Buffer(make([]byte, 64 * 1024), _max_line);
+  if !scanner.Scan() {
+    if err := scanner.Err(); err != nil {
+      return nil, err;
+    }
+    return nil, ErrFilterFormat;
+  }
+  head := scanner.Text();
+  if !strings.HasPrefix(head, _meta_prefix) {
+    return nil, ErrFilterFormat;
+  }
+  meta := &Meta{};
+  if err := json.Unmarshal([]byte(head[len(_meta_prefix):]), meta); err != nil {
+    return nil, err;
+  }
+  if (*meta).Mb <= 0 || (*meta).Count < 0 {
+    return nil, ErrFilterFormat;
+  }
+  return &FilterReader {
+    Meta: meta,
+    scanner: scanner,
+    row: ((*meta).Mb + 7) / 8,
+  }, nil;
+}
+
+/* next record, io.EOF after the last once the count in metadata is met */
+func (fr *FilterReader) Next() (*Filter, error) {
+  if !(*fr).scanner.Scan() {
+    if err := (*fr).scanner.Err(); err != nil {
+      return nil, err;
+    }
+    if (*fr).count != (*(*fr).Meta).Count {
+      return nil, ErrFilterCount;
+    }
+    return nil, io.EOF;
+  }
+  f, err := parse_filter((*fr).scanner.Text());
+  if err != nil {
+    return nil, err;
+  }
+  if len((*f).Bits) != (*fr).row {
+    return nil, ErrFilterFormat;
+  }
+  (*fr).count++;
+  if (*fr).count > (*(*fr).Meta).Count {
+    return nil, ErrFilterCount;
+  }
+  return f, nil;
+}
+
+/* parse a single "id,line,base64" line */
+func parse_filter(line string) (*Filter, error) {
+  column := strings.Split(line, ",");
+  if len(column) != 3 {
+    return nil, ErrFilterFormat;
+  }
+  n, err := strconv.Atoi(column[1]);
+  if err != nil {
+    return nil, ErrFilterFormat;
+  }
+  bits, err := base64.StdEncoding.DecodeString(column[2]);
+  if err != nil {
+    return nil, err;
+  }
+  return &Filter {
+    Id: unescape_id(column[0]),
+    Line: n,
+    Bits: bits,
+  }, nil;
+}
+
+/* percent-escape of identifiers, reversible so that distinct ids stay distinct */
+var _id_escaper = strings.NewReplacer("%", "%25", ",", "%2C", "\n", "%0A", "\r", "%0D");
+var _id_unescaper = strings.NewReplacer("%25", "%", "%2C", ",", "%0A", "\n", "%0D", "\r");
+
+/* keep identifiers on a single csv column */
+func escape_id(id string) (string) {
+  return _id_escaper.Replace(id);
+}
+
+/* identifier as written by escape_id */
+func unescape_id(id string) (string) {
+  return _id_unescaper.Replace(id);
+}
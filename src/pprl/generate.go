@@ -0,0 +1,344 @@
+package pprl;
+
+import "bufio";
+import "io";
+import "math";
+import "math/rand";
+import "strconv";
+import "strings";
+import "time";
+
+/* synthetic datasets with known matches */
+type GenerateOption struct {
+  SizeA int;                      // #record of the first dataset
+  SizeB int;                      // #record of the second dataset
+  Overlap float64;                // ratio of records in B whose entity is also in A
+  Duplicate float64;              // ratio of records duplicating an entity within the same dataset
+  Corrupt float64;                // probability a copied record is corrupted
+  MaxCorrupt int;                 // max #corruption of a corrupted record
+  Seed int64;                     // seed of the random source
+
+  /* relative weights of corruption models */
+  Typo float64;                   // keyboard insertion, deletion, substitution or transposition
+  OCR float64;                    // characters confused by optical character recognition
+  Phonetic float64;               // spellings that sound alike
+  Missing float64;                // value left empty
+  Swap float64;                   // values of two related fields swapped
+}
+
+/* columns of generated datasets, rec_id is the true entity and rec_key the record */
+var GenerateField = []string {
+  "rec_id", "given_name", "surname", "sex", "street_number", "address_1", "address_2",
+  "suburb", "postcode", "state", "date_of_birth", "phone_number", "soc_sec_id", "rec_key",
+};
+
+/* generated column index */
+const (
+  _gen_rec_id = iota;
+  _gen_given_name;
+  _gen_surname;
+  _gen_sex;
+  _gen_street_number;
+  _gen_address_1;
+  _gen_address_2;
+  _gen_suburb;
+  _gen_postcode;
+  _gen_state;
+  _gen_date_of_birth;
+  _gen_phone_number;
+  _gen_soc_sec_id;
+  _gen_rec_key;
+  _gen_nf;
+);
+
+/* corruption model index */
+const (
+  _corrupt_typo = iota;
+  _corrupt_ocr;
+  _corrupt_phonetic;
+  _corrupt_missing;
+  _corrupt_swap;
+);
+
+/* fields altered character-wise, sex and state are left to missing values */
+var _gen_text_field = []int {
+  _gen_given_name, _gen_surname, _gen_street_number, _gen_address_1, _gen_address_2,
+  _gen_suburb, _gen_postcode, _gen_date_of_birth, _gen_phone_number, _gen_soc_sec_id,
+};
+
+/* fields whose values get swapped with each other */
+var _gen_swap_field = [][2]int {
+  {_gen_given_name, _gen_surname},
+  {_gen_address_1, _gen_address_2},
+  {_gen_street_number, _gen_postcode},
+};
+
+/* default generator configs */
+const _default_gen_overlap = float64(0.5);
+const _default_gen_corrupt = float64(0.8);
+const _default_gen_max_corrupt = 2;
+const _default_gen_seed = 1;
+
+/* option with defaults, every corruption model equally likely */
+func NewGenerateOption(size_a, size_b int) (*GenerateOption) {
+  return &GenerateOption {
+    SizeA: size_a,
+    SizeB: size_b,
+    Overlap: _default_gen_overlap,
+    Corrupt: _default_gen_corrupt,
+    MaxCorrupt: _default_gen_max_corrupt,
+    Seed: _default_gen_seed,
+    Typo: 1,
+    OCR: 1,
+    Phonetic: 1,
+    Missing: 1,
+    Swap: 1,
+  };
+}
+
+/* check option values */
+func (opt *GenerateOption) check() (error) {
+  if (*opt).SizeA <= 0 || (*opt).SizeB <= 0 {
+    return ErrGenerateSize;
+  }
+  if (*opt).Overlap < 0 || (*opt).Overlap > 1 || (*opt).Duplicate < 0 || (*opt).Duplicate >= 1 || (*opt).Corrupt < 0 || (*opt).Corrupt > 1 {
+    return ErrGenerateRatio;
+  }
+  model := (*opt).model();
+  sum := float64(0);
+  for _, w := range model {
+    if w < 0 {
+      return ErrCorruptModel;
+    }
+    sum += w;
+  }
+  if (*opt).Corrupt > 0 && ((*opt).MaxCorrupt <= 0 || sum == 0) {
+    return ErrCorruptModel;
+  }
+  return nil;
+}
+
+/* weights indexed by corruption model */
+func (opt *GenerateOption) model() ([]float64) {
+  return []float64{(*opt).Typo, (*opt).OCR, (*opt).Phonetic, (*opt).Missing, (*opt).Swap};
+}
+
+/* generator state */
+type generator struct {
+  opt *GenerateOption;
+  r *rand.Rand;
+  model []float64;                // weights of corruption models
+  entity int;                     // #entity created
+}
+
+/*
+  generate two overlapping datasets as CSV with a head line;
+  records of the same entity share rec_id, copies may be corrupted
+*/
+func Generate(opt *GenerateOption, a, b io.Writer) (error) {
+  if err := opt.check(); err != nil {
+    return err;
+  }
+  g := &generator {
+    opt: opt,
+    r: rand.New(rand.NewSource((*opt).Seed)),
+    model: opt.model(),
+  };
+  ds_a := g.dataset((*opt).SizeA, nil, 0);
+  overlap := int(math.Round((*opt).Overlap * float64((*opt).SizeB)));
+  ds_b := g.dataset((*opt).SizeB, ds_a, overlap);
+  if err := write_generated(a, ds_a, "a"); err != nil {
+    return err;
+  }
+  return write_generated(b, ds_b, "b");
+}
+
+/* records of a dataset, the first n entities are copied from a distinct record of base */
+func (g *generator) dataset(size int, base [][]string, n int) ([][]string) {
+  dup := int(math.Round((*(*g).opt).Duplicate * float64(size)));
+  if n > size - dup {
+    n = size - dup;
+  }
+  if n > len(base) {
+    n = len(base);
+  }
+  rows := make([][]string, 0, size);
+  for _, i := range (*g).r.Perm(len(base))[:n] {
+    rows = append(rows, g.copy(base[i]));
+  }
+  for len(rows) < size - dup {
+    rows = append(rows, g.person());
+  }
+  unique := len(rows);
+  for len(rows) < size {
+    rows = append(rows, g.copy(rows[(*g).r.Intn(unique)]));
+  }
+  (*g).r.Shuffle(len(rows), func(i, j int) {
+    rows[i], rows[j] = rows[j], rows[i];
+  });
+  return rows;
+}
+
+/* a new entity */
+func (g *generator) person() ([]string) {
+  r := (*g).r;
+  row := make([]string, _gen_nf);
+  row[_gen_rec_id] = strconv.Itoa((*g).entity);
+  (*g).entity++;
+  if r.Intn(2) == 0 {
+    row[_gen_sex] = "f";
+    row[_gen_given_name] = g.pick(_given_name_f);
+  } else {
+    row[_gen_sex] = "m";
+    row[_gen_given_name] = g.pick(_given_name_m);
+  }
+  row[_gen_surname] = g.pick(_surname);
+  row[_gen_street_number] = strconv.Itoa(1 + g.skew(300));
+  row[_gen_address_1] = g.pick(_street);
+  if r.Float64() < 0.3 {
+    row[_gen_address_2] = g.pick(_address_2) + " " + strconv.Itoa(1 + r.Intn(40));
+  }
+  loc := _locality[g.skew(len(_locality))];
+  row[_gen_suburb] = loc[0];
+  row[_gen_postcode] = loc[1];
+  row[_gen_state] = loc[2];
+  from := time.Date(1930, 1, 1, 0, 0, 0, 0, time.UTC);
+  days := int(time.Date(2005, 12, 31, 0, 0, 0, 0, time.UTC).Sub(from).Hours() / 24);
+  row[_gen_date_of_birth] = from.AddDate(0, 0, r.Intn(days + 1)).Format("20060102");
+  row[_gen_phone_number] = "04" + digits(r, 8);
+  row[_gen_soc_sec_id] = strconv.Itoa(1000000 + r.Intn(9000000));
+  return row;
+}
+
+/* copy of a record, corrupted with probability Corrupt */
+func (g *generator) copy(src []string) ([]string) {
+  row := append([]string{}, src...);
+  if (*g).r.Float64() >= (*(*g).opt).Corrupt {
+    return row;
+  }
+  n := 1 + (*g).r.Intn((*(*g).opt).MaxCorrupt);
+  for i := 0; i < n; i++ {
+    g.corrupt(row);
+  }
+  return row;
+}
+
+/* apply one corruption drawn from the model */
+func (g *generator) corrupt(row []string) {
+  r := (*g).r;
+  field := _gen_text_field[r.Intn(len(_gen_text_field))];
+  switch g.choose((*g).model) {
+  case _corrupt_typo:
+    row[field] = typo(r, row[field]);
+  case _corrupt_ocr:
+    row[field] = substitute(r, row[field], _ocr);
+  case _corrupt_phonetic:
+    row[field] = substitute(r, row[field], _phonetic);
+  case _corrupt_missing:
+    row[_gen_given_name + r.Intn(_gen_soc_sec_id - _gen_given_name + 1)] = "";
+  case _corrupt_swap:
+    p := _gen_swap_field[r.Intn(len(_gen_swap_field))];
+    row[p[0]], row[p[1]] = row[p[1]], row[p[0]];
+  }
+}
+
+/* index drawn with probability proportional to weight */
+func (g *generator) choose(weight []float64) (int) {
+  sum := float64(0);
+  for _, w := range weight {
+    sum += w;
+  }
+  x := (*g).r.Float64() * sum;
+  for i, w := range weight {
+    if x < w {
+      return i;
+    }
+    x -= w;
+  }
+  return len(weight) - 1;
+}
+
+/* index in [0, n), smaller ones more likely */
+func (g *generator) skew(n int) (int) {
+  u := (*g).r.Float64();
+  return int(u * u * float64(n));
+}
+
+/* entry of a lookup table, earlier entries more likely */
+func (g *generator) pick(tbl []string) (string) {
+  return tbl[g.skew(len(tbl))];
+}
+
+/* n random digits */
+func digits(r *rand.Rand, n int) (string) {
+  b := make([]byte, n);
+  for i := range b {
+    b[i] = byte('0' + r.Intn(10));
+  }
+  return string(b);
+}
+
+/* a keyboard typo: substitution, insertion, deletion or transposition */
+func typo(r *rand.Rand, s string) (string) {
+  if s == "" {
+    return s;
+  }
+  b := []byte(s);
+  i := r.Intn(len(b));
+  near := _keyboard[b[i]];
+  switch op := r.Intn(4); {
+  case op == 0 && near != "":
+    b[i] = near[r.Intn(len(near))];
+  case op == 1 && near != "":
+    b = append(b[:i + 1], append([]byte{near[r.Intn(len(near))]}, b[i + 1:]...)...);
+  case op == 3 && len(b) > 1:
+    if i == len(b) - 1 {
+      i--;
+    }
+    b[i], b[i + 1] = b[i + 1], b[i];
+  default:
+    if len(b) > 1 {
+      b = append(b[:i], b[i + 1:]...);
+    }
+  }
+  return string(b);
+}
+
+/* replace one occurrence of a rule, either direction; falls back to a typo if no rule applies */
+func substitute(r *rand.Rand, s string, rules [][2]string) (string) {
+  type site struct {
+    at int;
+    from, to string;
+  }
+  var sites []site;
+  for _, rule := range rules {
+    for dir := 0; dir < 2; dir++ {
+      from, to := rule[dir], rule[1 - dir];
+      for at := 0; at + len(from) <= len(s); at++ {
+        if s[at:at + len(from)] == from {
+          sites = append(sites, site{at, from, to});
+        }
+      }
+    }
+  }
+  if len(sites) == 0 {
+    return typo(r, s);
+  }
+  c := sites[r.Intn(len(sites))];
+  return s[:c.at] + c.to + s[c.at + len(c.from):];
+}
+
+/* write records as CSV, rec_key is <prefix><line> */
+func write_generated(w io.Writer, rows [][]string, prefix string) (error) {
+  out := bufio.NewWriter(w);
+  if _, err := out.WriteString(strings.Join(GenerateField, ",") + "\n"); err != nil {
+    return err;
+  }
+  for i, row := range rows {
+    row[_gen_rec_key] = prefix + strconv.Itoa(i);
+    if _, err := out.WriteString(strings.Join(row, ",") + "\n"); err != nil {
+      return err;
+    }
+  }
+  return out.Flush();
+}
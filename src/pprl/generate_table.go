@@ -0,0 +1,94 @@
+package pprl;
+
+/* lookup tables for synthetic data, earlier entries are drawn more often */
+
+var _given_name_f = []string {
+  "mary", "patricia", "jennifer", "linda", "elizabeth", "barbara", "susan", "jessica",
+  "sarah", "karen", "lisa", "nancy", "betty", "margaret", "sandra", "ashley",
+  "kimberly", "emily", "donna", "michelle", "carol", "amanda", "melissa", "deborah",
+  "stephanie", "rebecca", "sharon", "laura", "cynthia", "kathleen", "amy", "angela",
+  "shirley", "anna", "brenda", "pamela", "emma", "nicole", "helen", "samantha",
+  "katherine", "christine", "debra", "rachel", "catherine", "carolyn", "janet", "ruth",
+  "maria", "heather", "diane", "virginia", "julie", "joyce", "victoria", "olivia",
+  "kelly", "christina", "lauren", "joan", "evelyn", "judith", "megan", "cheryl",
+};
+
+var _given_name_m = []string {
+  "james", "robert", "john", "michael", "david", "william", "richard", "joseph",
+  "thomas", "charles", "christopher", "daniel", "matthew", "anthony", "mark", "donald",
+  "steven", "paul", "andrew", "joshua", "kenneth", "kevin", "brian", "george",
+  "timothy", "ronald", "edward", "jason", "jeffrey", "ryan", "jacob", "gary",
+  "nicholas", "eric", "jonathan", "stephen", "larry", "justin", "scott", "brandon",
+  "benjamin", "samuel", "gregory", "alexander", "frank", "patrick", "raymond", "jack",
+  "dennis", "jerry", "tyler", "aaron", "jose", "adam", "nathan", "henry",
+  "douglas", "zachary", "peter", "kyle", "ethan", "walter", "noah", "jeremy",
+};
+
+var _surname = []string {
+  "smith", "jones", "williams", "brown", "wilson", "taylor", "johnson", "white",
+  "martin", "anderson", "thompson", "nguyen", "thomas", "walker", "harris", "lee",
+  "ryan", "robinson", "kelly", "king", "davis", "wright", "evans", "roberts",
+  "green", "hall", "wood", "jackson", "clarke", "patel", "khan", "lewis",
+  "james", "phillips", "mason", "mitchell", "rose", "davies", "rodriguez", "cox",
+  "alexander", "morris", "harrison", "campbell", "stewart", "scott", "murray", "young",
+  "cooper", "watson", "baker", "bell", "graham", "kennedy", "hughes", "edwards",
+  "morgan", "turner", "ward", "collins", "macdonald", "shaw", "fraser", "reid",
+  "schmidt", "mueller", "schneider", "fischer", "weber", "meyer", "wagner", "becker",
+  "tran", "le", "pham", "huynh", "chen", "wang", "zhang", "liu",
+};
+
+var _street = []string {
+  "main street", "high street", "church street", "park road", "victoria street",
+  "station road", "george street", "queen street", "king street", "elizabeth street",
+  "william street", "albert street", "railway parade", "bridge road", "river road",
+  "hill street", "short street", "long street", "wattle avenue", "acacia avenue",
+  "banksia crescent", "eucalyptus drive", "ocean parade", "beach road", "lake view drive",
+  "forest road", "mountain road", "garden street", "mill lane", "school road",
+  "cemetery road", "hospital road", "collins street", "bourke street", "swanston street",
+  "flinders lane", "chapel street", "glenferrie road", "burke road", "toorak road",
+};
+
+var _address_2 = []string {
+  "unit", "flat", "apartment", "suite", "villa", "level", "rear", "shop",
+};
+
+/* suburb, postcode and state come together */
+var _locality = [][3]string {
+  {"melbourne", "3000", "vic"}, {"carlton", "3053", "vic"}, {"fitzroy", "3065", "vic"},
+  {"richmond", "3121", "vic"}, {"brunswick", "3056", "vic"}, {"hawthorn", "3122", "vic"},
+  {"kew", "3101", "vic"}, {"st kilda", "3182", "vic"}, {"geelong", "3220", "vic"},
+  {"ballarat", "3350", "vic"}, {"bendigo", "3550", "vic"}, {"sydney", "2000", "nsw"},
+  {"parramatta", "2150", "nsw"}, {"newtown", "2042", "nsw"}, {"bondi", "2026", "nsw"},
+  {"manly", "2095", "nsw"}, {"newcastle", "2300", "nsw"}, {"wollongong", "2500", "nsw"},
+  {"brisbane", "4000", "qld"}, {"toowong", "4066", "qld"}, {"southport", "4215", "qld"},
+  {"cairns", "4870", "qld"}, {"townsville", "4810", "qld"}, {"adelaide", "5000", "sa"},
+  {"glenelg", "5045", "sa"}, {"perth", "6000", "wa"}, {"fremantle", "6160", "wa"},
+  {"hobart", "7000", "tas"}, {"launceston", "7250", "tas"}, {"darwin", "0800", "nt"},
+  {"canberra", "2600", "act"}, {"belconnen", "2617", "act"},
+};
+
+/* characters next to each other on a qwerty keyboard */
+var _keyboard = map[byte]string {
+  'a': "qwsz", 'b': "vghn", 'c': "xdfv", 'd': "serfcx", 'e': "wsdr", 'f': "drtgvc",
+  'g': "ftyhbv", 'h': "gyujnb", 'i': "ujko", 'j': "huikmn", 'k': "jiolm", 'l': "kop",
+  'm': "njk", 'n': "bhjm", 'o': "iklp", 'p': "ol", 'q': "wa", 'r': "edft",
+  's': "awedxz", 't': "rfgy", 'u': "yhji", 'v': "cfgb", 'w': "qase", 'x': "zsdc",
+  'y': "tghu", 'z': "asx",
+  '0': "9", '1': "2", '2': "13", '3': "24", '4': "35", '5': "46", '6': "57",
+  '7': "68", '8': "79", '9': "80",
+};
+
+/* characters confused by optical character recognition, both directions apply */
+var _ocr = [][2]string {
+  {"0", "o"}, {"1", "l"}, {"1", "i"}, {"5", "s"}, {"8", "b"}, {"2", "z"},
+  {"6", "g"}, {"m", "rn"}, {"w", "vv"}, {"d", "cl"}, {"h", "li"}, {"u", "v"},
+  {"e", "c"}, {"n", "ri"},
+};
+
+/* spellings that sound alike, both directions apply */
+var _phonetic = [][2]string {
+  {"ph", "f"}, {"ck", "k"}, {"c", "k"}, {"ie", "y"}, {"ei", "ie"}, {"th", "t"},
+  {"z", "s"}, {"mm", "m"}, {"nn", "n"}, {"ll", "l"}, {"ou", "ow"}, {"ae", "e"},
+  {"gh", "g"}, {"kn", "n"}, {"wr", "r"}, {"sch", "sh"}, {"x", "ks"}, {"qu", "kw"},
+  {"tt", "t"}, {"ss", "s"}, {"ey", "y"}, {"son", "sen"}, {"man", "mann"},
+};
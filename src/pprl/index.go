@@ -0,0 +1,125 @@
+package pprl;
+
+import "context";
+import "io";
+import "strconv";
+
+/*
+  encoded records with their block tables, for linking daily feeds without
+  re-encoding; persisted as encoded output whose metadata carries the
+  encoding schema and blocking parameters, tables are rebuilt when read
+*/
+type Index struct {
+  Meta *Meta;                   // schema, blocking and #record
+  Filter []*Filter;             // indexed records, in insertion order
+  opt *CompareOption;           // blocking follows Meta.Block
+  positions [][]int;            // sampled bits of each blocking iteration
+  table []map[uint64][]int;     // block key to filter index, per iteration
+  last int;                     // largest line number indexed
+}
+
+/* index filters; blocking is taken from meta if set, otherwise from opt and recorded in meta */
+func NewIndex(meta *Meta, filters []*Filter, opt *CompareOption) (*Index) {
+  o := *opt;
+  o.Mb = (*meta).Mb;
+  if (*meta).Block != nil {
+    o.Blk = (*(*meta).Block).Bit;
+    o.Iter = (*(*meta).Block).Iter;
+    o.Seed = (*(*meta).Block).Seed;
+  } else {
+    (*meta).Block = &BlockMeta{o.Blk, o.Iter, o.Seed};
+  }
+  x := &Index {
+    Meta: meta,
+    opt: &o,
+    positions: sample_bits(&o),
+  };
+  (*x).table = block_index(nil, (*x).positions);
+  x.insert(filters);
+  return x;
+}
+
+/* read an index written by Index.Write, or any encoded output */
+func ReadIndex(r io.Reader, opt *CompareOption) (*Index, error) {
+  meta, filters, err := ReadFilters(r);
+  if err != nil {
+    return nil, err;
+  }
+  return NewIndex(meta, filters, opt), nil;
+}
+
+/* persist schema, blocking and records */
+func (x *Index) Write(w io.Writer) (error) {
+  return WriteFilters(w, (*x).Meta, (*x).Filter);
+}
+
+/* match filters against indexed records, blocked by the index tables */
+func (x *Index) Match(ctx context.Context, filters []*Filter) (*CompareResult, error) {
+  if err := x.check_bits(filters); err != nil {
+    return nil, err;
+  }
+  return compare_index(ctx, filters, (*x).Filter, (*x).opt, (*x).positions, (*x).table);
+}
+
+/*
+  add new records; their line numbers continue after the indexed ones, as if
+  appended to the source, and are updated in place, as are identifiers that
+  are their line number (no id_field); returns their matches against other
+  (nil for this index before insertion)
+*/
+func (x *Index) Append(ctx context.Context, filters []*Filter, other *Index) (*CompareResult, error) {
+  if other == nil {
+    other = x;
+  }
+  if SchemaHash((*other).Meta) != SchemaHash((*x).Meta) {
+    return nil, ErrSchemaMismatch;
+  }
+  if err := x.check_bits(filters); err != nil {
+    return nil, err;
+  }
+  /* new lines start right after the last one, the head line is not repeated */
+  first := -1;
+  for _, f := range filters {
+    if first < 0 || (*f).Line < first {
+      first = (*f).Line;
+    }
+  }
+  shift := (*x).last + 1 - first;
+  if (*x).last == 0 {
+    shift = 0;
+  }
+  for _, f := range filters {
+    if (*f).Id == strconv.Itoa((*f).Line) {
+      (*f).Id = strconv.Itoa((*f).Line + shift);
+    }
+    (*f).Line += shift;
+  }
+  result, err := other.Match(ctx, filters);
+  if err != nil {
+    return nil, err;
+  }
+  x.insert(filters);
+  return result, nil;
+}
+
+/* add filters to records and block tables */
+func (x *Index) insert(filters []*Filter) {
+  add_block((*x).table, filters, (*x).positions, len((*x).Filter));
+  (*x).Filter = append((*x).Filter, filters...);
+  (*(*x).Meta).Count = len((*x).Filter);
+  for _, f := range filters {
+    if (*f).Line > (*x).last {
+      (*x).last = (*f).Line;
+    }
+  }
+}
+
+/* filters should have the #bit of the index */
+func (x *Index) check_bits(filters []*Filter) (error) {
+  for _, f := range filters {
+    if len((*f).Bits) != ((*(*x).Meta).Mb + 7) / 8 {
+      return ErrIndexBit;
+    }
+  }
+  return nil;
+}
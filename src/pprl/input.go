@@ -0,0 +1,82 @@
+package pprl;
+
+import "context";
+import "io";
+
+import "util/tannhauser/pool";
+
+/* config built in code, only exported fields of conf are used, Dataset/Prefix/Size are ignored */
+func NewConfig(conf Config, debug bool) (*Config, error) {
+  cf := &conf;
+  (*cf).debug = debug;
+  (*cf).workers = &pool.WorkerPool{};
+  (*cf).progress = nil;
+  (*cf).fp = nil;
+  (*cf).dataset = nil;
+  (*cf).nd = 0;
+  (*cf).plan = nil;
+  (*cf).analyzed = false;
+  if err := check_problems(cf.validate_fields()); err != nil {
+    return nil, err;
+  }
+  if err := cf.init_value(); err != nil {
+    return nil, err;
+  }
+  if err := cf.init_key(); err != nil {
+    return nil, err;
+  }
+  if err := cf.init_buffers(); err != nil {
+    return nil, err;
+  }
+  return cf, nil;
+}
+
+/* add a dataset from csv lines in r, head line first, size is the expected #record (0 if unknown); returns the dataset index */
+func (cf *Config) LoadReader(r io.Reader, size int) (int, error) {
+  return cf.LoadReaderContext(context.Background(), r, size);
+}
+
+/* add a dataset from csv lines in r until ctx is done */
+func (cf *Config) LoadReaderContext(ctx context.Context, r io.Reader, size int) (int, error) {
+  if size < 0 {
+    return -1, ErrSize;
+  }
+  d := cf.new_dataset(size);
+  if err := cf.load_reader(ctx, (*d).index, r); err != nil {
+    cf.drop_dataset();
+    return -1, err;
+  }
+  return (*d).index, nil;
+}
+
+/* add a dataset from in-memory rows, head holds the field names; returns the dataset index */
+func (cf *Config) LoadRecords(head []string, rows [][]string) (int, error) {
+  if len(head) < (*(*cf).Nf) {
+    return -1, ErrRecordField;
+  }
+  for _, row := range rows {
+    if len(row) < (*(*cf).Nf) {
+      return -1, ErrRecordField;
+    }
+  }
+  d := cf.new_dataset(len(rows));
+  progress := new_progress((*cf).progress, StageLoad, (*d).index, int64(len(rows)));
+  cf.add_row(d, 0, head);
+  for i, row := range rows {
+    /* line numbers as if head line were line 1 */
+    if err := cf.add_row(d, i + 1, row); err != nil {
+      cf.drop_dataset();
+      return -1, err;
+    }
+    progress.add(1);
+  }
+  cf.finish_dataset(d, len(rows) + 1);
+  return (*d).index, nil;
+}
+
+/* remove the last dataset after a failed load */
+func (cf *Config) drop_dataset() {
+  (*cf).nd--;
+  (*cf).dataset = (*cf).dataset[:(*cf).nd];
+  (*cf).fp = (*cf).fp[:(*cf).nd];
+}
@@ -0,0 +1,177 @@
+package pprl;
+
+import "crypto/hmac";
+import "crypto/md5";
+import "crypto/rand";
+import "crypto/sha256";
+import "encoding/base64";
+import "encoding/json";
+import "hash";
+import "os";
+import "time";
+
+/* algorithms of keyed hashing */
+const KeyHMACSHA256 = "hmac-sha256";
+
+/* shortest secret accepted, in bytes */
+const _min_secret = 16;
+const _default_secret = 32;
+
+/* secret for keyed hashing; only its id goes into encoded output */
+type Key struct {
+  Id string `json:"id"`;                   // name of the key, unique in its file
+  Algorithm string `json:"algorithm"`;     // keyed hash, see KeyHMACSHA256
+  Created string `json:"created"`;         // creation time, RFC 3339 UTC
+  Secret string `json:"secret"`;           // secret, base64
+  secret []byte;                          // decoded secret
+}
+
+/*
+  keys of a project; rotating adds a newer key, older ones are kept so that
+  files encoded under them can still be told apart and re-encoded
+*/
+type KeyFile struct {
+  Key []*Key `json:"keys"`;
+}
+
+/* read and check a key file */
+func ReadKeyFile(path string) (*KeyFile, error) {
+  data, err := os.ReadFile(path);
+  if err != nil {
+    return nil, err;
+  }
+  kf := &KeyFile{};
+  if err = json.Unmarshal(data, kf); err != nil {
+    return nil, ErrKeyFile;
+  }
+  seen := make(map[string]bool);
+  for _, k := range (*kf).Key {
+    if k == nil || (*k).Id == "" || seen[(*k).Id] {
+      return nil, ErrKeyId;
+    }
+    seen[(*k).Id] = true;
+    if (*k).Algorithm != KeyHMACSHA256 {
+      return nil, ErrKeyAlgorithm;
+    }
+    if _, err = time.Parse(time.RFC3339, (*k).Created); err != nil {
+      return nil, ErrKeyFile;
+    }
+    if (*k).secret, err = base64.StdEncoding.DecodeString((*k).Secret); err != nil || len((*k).secret) < _min_secret {
+      return nil, ErrKeyFile;
+    }
+  }
+  return kf, nil;
+}
+
+/* write the key file readable by owner only, replacing path at once */
+func (kf *KeyFile) Write(path string) (error) {
+  data, err := json.MarshalIndent(kf, "", "  ");
+  if err != nil {
+    return err;
+  }
+  tmp := path + ".tmp";
+  if err = os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+    return err;
+  }
+  return os.Rename(tmp, path);
+}
+
+/* key of id, the newest key if id is empty */
+func (kf *KeyFile) Get(id string) (*Key, error) {
+  var newest *Key;
+  for _, k := range (*kf).Key {
+    if id != "" && (*k).Id == id {
+      return k, nil;
+    }
+    /* RFC 3339 UTC times sort as strings, later keys win ties */
+    if newest == nil || (*k).Created >= (*newest).Created {
+      newest = k;
+    }
+  }
+  if id != "" || newest == nil {
+    return nil, ErrKeyId;
+  }
+  return newest, nil;
+}
+
+/* add a new random key, which becomes the newest */
+func (kf *KeyFile) Add(id string, created time.Time) (*Key, error) {
+  if id == "" {
+    return nil, ErrKeyId;
+  }
+  for _, k := range (*kf).Key {
+    if (*k).Id == id {
+      return nil, ErrKeyId;
+    }
+  }
+  secret := make([]byte, _default_secret);
+  if _, err := rand.Read(secret); err != nil {
+    return nil, err;
+  }
+  k := &Key {
+    Id: id,
+    Algorithm: KeyHMACSHA256,
+    Created: created.UTC().Format(time.RFC3339),
+    Secret: base64.StdEncoding.EncodeToString(secret),
+    secret: secret,
+  };
+  (*kf).Key = append((*kf).Key, k);
+  return k, nil;
+}
+
+/* hash instance of the key, unkeyed md5 for nil */
+func (k *Key) new_hash() (hash.Hash) {
+  if k == nil {
+    return md5.New();
+  }
+  return hmac.New(sha256.New, (*k).secret);
+}
+
+/* id of the key, empty for nil */
+func (k *Key) id() (string) {
+  if k == nil {
+    return "";
+  }
+  return (*k).Id;
+}
+
+/* load key_file and pick key_id */
+func (cf *Config) init_key() (error) {
+  var err error;
+  (*cf).keys, (*cf).key = nil, nil;
+  if (*cf).KeyFile == "" {
+    if (*cf).KeyId != "" {
+      return ErrKeyId;
+    }
+    return nil;
+  }
+  if (*cf).keys, err = ReadKeyFile((*cf).KeyFile); err != nil {
+    return err;
+  }
+  (*cf).key, err = (*cf).keys.Get((*cf).KeyId);
+  return err;
+}
+
+/* id of the key encoding with, empty if unkeyed */
+func (cf *Config) ActiveKey() (string) {
+  return (*cf).key.id();
+}
+
+/* encode with another key of key_file from now on, for re-encoding under a rotated key */
+func (cf *Config) UseKey(id string) (error) {
+  if (*cf).keys == nil {
+    return ErrKeyId;
+  }
+  key, err := (*cf).keys.Get(id);
+  if err != nil {
+    return err;
+  }
+  (*cf).key = key;
+  (*cf).KeyId = (*key).Id;
+  if (*cf).enc != nil {
+    for _, h := range (*cf).enc.hashes.hash {
+      (*h).hash = key.new_hash();
+    }
+  }
+  return nil;
+}
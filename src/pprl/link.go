@@ -0,0 +1,194 @@
+package pprl;
+
+import "bufio";
+import "context";
+import "fmt";
+import "io";
+import "sort";
+
+/* record of a cluster */
+type Member struct {
+  Dataset int;                  // index of the set the record comes from
+  Id string;                    // identifier of record
+  Line int;                     // line number of record
+}
+
+/* records of the same entity across sets, at most one per set */
+type Cluster struct {
+  Id int;                       // cluster identifier, ordered by first member
+  Member []*Member;             // members, ordered by set
+  Links int;                    // #match among members
+  MinScore float64;             // lowest score of matches among members
+  Confidence float64;           // sum of scores among members / #member pairs
+}
+
+/* multi-party linkage output */
+type LinkResult struct {
+  Cluster []*Cluster;           // clusters of at least 2 records
+  Candidate int64;              // #pair compared after blocking, over all set pairs
+  Match int;                    // #match over all set pairs
+  Rejected int;                 // #match left out as it would put 2 records of a set in a cluster
+}
+
+/* match between records of two sets, node is the record index over all sets */
+type link_edge struct {
+  a, b int;
+  score float64;
+}
+
+/* link all datasets of config */
+func (cf *Config) Link(ctx context.Context) (*LinkResult, error) {
+  sets := make([][]*Filter, (*cf).nd);
+  for i := range sets {
+    sets[i] = cf.Filters(i);
+  }
+  return Link(ctx, sets, cf.compare_option());
+}
+
+/*
+  compare every pair of sets and cluster records by descending score;
+  a match joining two clusters that already hold records of the same set
+  is rejected, so that clusters never link a set to itself
+*/
+func Link(ctx context.Context, sets [][]*Filter, opt *CompareOption) (*LinkResult, error) {
+  if len(sets) < 2 {
+    return nil, ErrCompareDataset;
+  }
+  result := &LinkResult{};
+  offset := make([]int, len(sets) + 1);
+  for i, s := range sets {
+    offset[i + 1] = offset[i] + len(s);
+  }
+  var edges []link_edge;
+  for i := 0; i < len(sets); i++ {
+    for j := i + 1; j < len(sets); j++ {
+      pos_a := filter_index(sets[i]);
+      pos_b := filter_index(sets[j]);
+      cmp, err := CompareContext(ctx, sets[i], sets[j], opt);
+      if err != nil {
+        return nil, err;
+      }
+      (*result).Candidate += (*cmp).Candidate;
+      (*result).Match += len((*cmp).Match);
+      for _, m := range (*cmp).Match {
+        edges = append(edges, link_edge{offset[i] + pos_a[(*m).LineA], offset[j] + pos_b[(*m).LineB], (*m).Score});
+      }
+    }
+  }
+  sort.Slice(edges, func(x, y int) (bool) {
+    if edges[x].score != edges[y].score {
+      return edges[x].score > edges[y].score;
+    }
+    if edges[x].a != edges[y].a {
+      return edges[x].a < edges[y].a;
+    }
+    return edges[x].b < edges[y].b;
+  });
+  /* union-find, each root keeps the sets present in its cluster */
+  set_of := func(node int) (int) {
+    return sort.SearchInts(offset, node + 1) - 1;
+  };
+  parent := make([]int, offset[len(sets)]);
+  present := make([]map[int]bool, len(parent));
+  for i := range parent {
+    parent[i] = i;
+  }
+  find := func(i int) (int) {
+    for parent[i] != i {
+      parent[i] = parent[parent[i]];
+      i = parent[i];
+    }
+    return i;
+  };
+  for _, e := range edges {
+    ra, rb := find(e.a), find(e.b);
+    if ra == rb {
+      continue;
+    }
+    pa, pb := present[ra], present[rb];
+    if pa == nil {
+      pa = map[int]bool{set_of(ra): true};
+    }
+    if pb == nil {
+      pb = map[int]bool{set_of(rb): true};
+    }
+    conflict := false;
+    for s := range pb {
+      if pa[s] {
+        conflict = true;
+        break;
+      }
+    }
+    if conflict {
+      (*result).Rejected++;
+      continue;
+    }
+    for s := range pb {
+      pa[s] = true;
+    }
+    parent[rb] = ra;
+    present[ra] = pa;
+    present[rb] = nil;
+  }
+  /* group records, nodes are visited in set order so members come out sorted */
+  index := make(map[int]*Cluster);
+  for node := range parent {
+    root := find(node);
+    if present[root] == nil {
+      continue;
+    }
+    c, ok := index[root];
+    if !ok {
+      c = &Cluster {
+        Id: len((*result).Cluster),
+        MinScore: 1,
+      };
+      index[root] = c;
+      (*result).Cluster = append((*result).Cluster, c);
+    }
+    s := set_of(node);
+    f := sets[s][node - offset[s]];
+    (*c).Member = append((*c).Member, &Member{s, (*f).Id, (*f).Line});
+  }
+  /* confidence from every match among members, including those not needed to join them */
+  sum := make(map[*Cluster]float64);
+  for _, e := range edges {
+    ra := find(e.a);
+    if ra != find(e.b) || present[ra] == nil {
+      continue;
+    }
+    c := index[ra];
+    (*c).Links++;
+    sum[c] += e.score;
+    if e.score < (*c).MinScore {
+      (*c).MinScore = e.score;
+    }
+  }
+  for _, c := range (*result).Cluster {
+    n := len((*c).Member);
+    (*c).Confidence = sum[c] / float64(n * (n - 1) / 2);
+  }
+  return result, nil;
+}
+
+/* position of each filter by line number */
+func filter_index(filters []*Filter) (map[int]int) {
+  pos := make(map[int]int, len(filters));
+  for i, f := range filters {
+    pos[(*f).Line] = i;
+  }
+  return pos;
+}
+
+/* write one "cluster,dataset,id,line,confidence" line per member */
+func WriteClusters(w io.Writer, clusters []*Cluster) (error) {
+  bw := bufio.NewWriter(w);
+  for _, c := range clusters {
+    for _, m := range (*c).Member {
+      if _, err := fmt.Fprintf(bw, "%d,%d,%s,%d,%.6f\n", (*c).Id, (*m).Dataset, escape_id((*m).Id), (*m).Line, (*c).Confidence); err != nil {
+        return err;
+      }
+    }
+  }
+  return bw.Flush();
+}
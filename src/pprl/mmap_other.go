@@ -0,0 +1,12 @@
+//go:build !unix
+
+package pprl;
+
+import "io";
+import "os";
+
+/* no mapping on this platform, the file is read into memory */
+func map_file(fp *os.File) ([]byte, func([]byte) (error), error) {
+  data, err := io.ReadAll(fp);
+  return data, nil, err;
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package pprl;
+
+import "os";
+import "syscall";
+
+/* map a file read-only, returns the mapping and how to release it */
+func map_file(fp *os.File) ([]byte, func([]byte) (error), error) {
+  info, err := fp.Stat();
+  if err != nil {
+    return nil, nil, err;
+  }
+  if info.Size() == 0 {
+    return nil, nil, ErrBinaryFormat;
+  }
+  data, err := syscall.Mmap(int(fp.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED);
+  if err != nil {
+    return nil, nil, err;
+  }
+  return data, syscall.Munmap, nil;
+}
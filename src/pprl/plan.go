@@ -0,0 +1,218 @@
+package pprl;
+
+import "fmt";
+import "io";
+import "math";
+
+/* encoding parameters of a single field */
+type FieldPlan struct {
+  Index int;                    // field index
+  Name string;                  // field name
+  Ignored bool;                 // field is ignored
+  Weight float64;               // field weight
+  G float64;                    // average #n-gram
+  M int;                        // #bit assigned to the field
+  K int;                        // #hash, after min/max enforcement
+  RawK float64;                 // #hash before rounding and enforcement
+  Clamped bool;                 // K differs from floor(RawK) due to min/max enforcement
+  Fill float64;                 // expected ratio of on bits within the assigned bits
+  FPR float64;                  // expected false positive rate of a single n-gram
+}
+
+/* encoding parameters of all fields */
+type Plan struct {
+  Mb int;                       // #bit in the bloom filter
+  Ratio float64;                // target ratio of off bits
+  MinK int;                     // minimum #hash per field
+  MaxK int;                     // maximum #hash per field
+  Fill float64;                 // expected ratio of on bits in the whole bloom filter
+  Field []*FieldPlan;           // per field parameters
+}
+
+/* planning error bound to a field */
+type PlanError struct {
+  Field int;                    // field index
+  Name string;                  // field name
+  Err error;                    // actual error
+}
+
+func (e *PlanError) Error() (string) {
+  return fmt.Sprintf("field %d (%s): %s", (*e).Field, (*e).Name, (*e).Err.Error());
+}
+
+/* compute m and k of each field from weights and average n-gram counts */
+func (cf *Config) plan_encoding() (error) {
+  if (*(*cf).Ratio) <= 0 || (*(*cf).Ratio) >= 1 {
+    return ErrRatio;
+  }
+  if (*cf).MinK < 1 || (*cf).MaxK < (*cf).MinK {
+    return ErrHashRange;
+  }
+  p := &Plan {
+    Mb: (*cf).Mb,
+    Ratio: (*(*cf).Ratio),
+    MinK: (*cf).MinK,
+    MaxK: (*cf).MaxK,
+    Field: make([]*FieldPlan, (*(*cf).Nf)),
+  };
+  active := 0;
+  for i := 0; i < (*(*cf).Nf); i++ {
+    (*p).Field[i] = &FieldPlan {
+      Index: i,
+      Name: cf.field_name(i),
+      Ignored: (*cf).ignore[i],
+      Weight: (*cf).weight[i],
+      G: (*cf).g[i],
+    };
+    if !(*cf).ignore[i] {
+      active++;
+    }
+  }
+  if active == 0 {
+    return ErrNoField;
+  }
+
+  /* distribute bits */
+  m, err := distribute_bits((*cf).weight, (*cf).ignore, (*cf).Mb);
+  if err != nil {
+    return err;
+  }
+
+  /* calculate k_i, the expected ratio of off bits is ((m - 1) / m) ^ (k * g) */
+  ratio := math.Log2((*(*cf).Ratio));
+  sum_kg := float64(0);
+  var f *FieldPlan;
+  for i := 0; i < (*(*cf).Nf); i++ {
+    f = (*p).Field[i];
+    (*f).M = m[i];
+    (*cf).m[i] = m[i];
+    (*cf).k[i] = 0;
+    if (*f).Ignored {
+      continue;
+    }
+    if math.IsNaN((*f).G) || (*f).G <= 0 {
+      return &PlanError{i, (*f).Name, ErrNoNgram};
+    }
+    if (*f).M == 0 {
+      return &PlanError{i, (*f).Name, ErrNoBit};
+    }
+    if (*f).M < 2 {
+      return &PlanError{i, (*f).Name, ErrTooFewBit};
+    }
+    (*f).RawK = (ratio / math.Log2(float64((*f).M - 1) / float64((*f).M))) / (*f).G;
+    (*f).K = int((*f).RawK);
+    if (*f).K < (*cf).MinK {
+      (*f).K = (*cf).MinK;
+      (*f).Clamped = true;
+    }
+    if (*f).K > (*cf).MaxK {
+      (*f).K = (*cf).MaxK;
+      (*f).Clamped = true;
+    }
+    (*cf).k[i] = (*f).K;
+    (*f).estimate();
+    sum_kg += float64((*f).K) * (*f).G;
+  }
+  /* all fields are hashed into the whole bloom filter */
+  (*p).Fill = 1 - math.Pow(float64((*cf).Mb - 1) / float64((*cf).Mb), sum_kg);
+  (*cf).plan = p;
+  return nil;
+}
+
+/* distribute #bit to non-ignored fields according to their weights */
+func distribute_bits(weight []float64, ignore []bool, mb int) ([]int, error) {
+  nf := len(weight);
+  m := make([]int, nf);
+  /* first distribution */
+  sum := 0;
+  for i := 0; i < nf; i++ {
+    if ignore[i] {
+      continue;
+    }
+    if math.IsNaN(weight[i]) || weight[i] < 0 {
+      return nil, ErrZeroWeight;
+    }
+    m[i] = int(math.Floor(float64(mb) * weight[i]));
+    sum += m[i];
+  }
+  /* distribute remaining bits, one per round to the fields with least bits */
+  dif := mb - sum;
+  if dif < 0 {
+    return nil, ErrMb;
+  }
+  distributed := make([]bool, nf);
+  index := 0;
+  for dif > 0 {
+    index = -1;
+    for j := 0; j < nf; j++ {
+      if ignore[j] || distributed[j] || weight[j] == 0 {
+        continue;
+      }
+      if index < 0 || m[j] < m[index] {
+        index = j;
+      }
+    }
+    if index < 0 {
+      /* every field got one bit in this round, start a new round */
+      cnt := 0;
+      for j := 0; j < nf; j++ {
+        if distributed[j] {
+          distributed[j] = false;
+          cnt++;
+        }
+      }
+      if cnt == 0 {
+        return nil, ErrMbDistribution;
+      }
+      continue;
+    }
+    m[index]++;
+    distributed[index] = true;
+    dif--;
+  }
+  /* check sum of #bit */
+  sum = 0;
+  for i := 0; i < nf; i++ {
+    sum += m[i];
+  }
+  if sum != mb {
+    return nil, ErrMbDistribution;
+  }
+  return m, nil;
+}
+
+/* expected fill ratio and false positive rate with the final k */
+func (f *FieldPlan) estimate() {
+  off := math.Pow(float64((*f).M - 1) / float64((*f).M), float64((*f).K) * (*f).G);
+  (*f).Fill = 1 - off;
+  (*f).FPR = math.Pow((*f).Fill, float64((*f).K));
+}
+
+/* get encoding plan, nil before PrepareDataset */
+func (cf *Config) Plan() (*Plan) {
+  return (*cf).plan;
+}
+
+/* display encoding plan */
+func (p *Plan) Print(w io.Writer) {
+  fmt.Fprintf(w, "mb: %d, ratio: %f, min_hash: %d, max_hash: %d, expected fill: %f\n", (*p).Mb, (*p).Ratio, (*p).MinK, (*p).MaxK, (*p).Fill);
+  for _, f := range (*p).Field {
+    if (*f).Ignored {
+      fmt.Fprintf(w, "[%d][%s] ignored\n", (*f).Index, (*f).Name);
+      continue;
+    }
+    clamped := "";
+    if (*f).Clamped {
+      clamped = fmt.Sprintf(" (clamped from %f)", (*f).RawK);
+    }
+    fmt.Fprintf(w, "[%d][%s] weight: %f, g: %f, m: %d, k: %d%s, fill: %f, fpr: %e\n", (*f).Index, (*f).Name, (*f).Weight, (*f).G, (*f).M, (*f).K, clamped, (*f).Fill, (*f).FPR);
+  }
+}
+
+/* get field name from the head line of the first dataset */
+func (cf *Config) field_name(i int) (string) {
+  if (*cf).nd > 0 && (*cf).dataset[0] != nil && (*(*cf).dataset[0]).field != nil {
+    return (*(*(*cf).dataset[0]).field[i]).name;
+  }
+  return fmt.Sprintf("field_%d", i);
+}
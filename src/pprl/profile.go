@@ -0,0 +1,218 @@
+package pprl;
+
+import "fmt";
+import "io";
+import "sort";
+import "strings";
+
+/* a value and its #occurrence */
+type ValueCount struct {
+  Value string `json:"value"`;
+  Count int `json:"count"`;
+}
+
+/* statistics of a field in a dataset */
+type FieldProfile struct {
+  Index int `json:"index"`;                   // field index
+  Name string `json:"name"`;                   // field name
+  Ignored bool `json:"ignored"`;               // field is ignored, only missingness is reported
+  Total int `json:"total"`;                    // #record
+  Missing int `json:"missing"`;                // #record without the field
+  MissingRate float64 `json:"missing_rate"`;   // 1 - exists/total
+  Distinct int `json:"distinct"`;              // #distinct value
+  Entropy float64 `json:"entropy"`;            // entropy of values
+  Top []ValueCount `json:"top"`;               // most frequent values
+  AvgNgram float64 `json:"avg_ngram"`;         // average #n-gram of present values
+  NgramHistogram []int `json:"ngram_histogram"`; // #record by #n-gram, index is #n-gram
+}
+
+/* statistics of a dataset */
+type DatasetProfile struct {
+  Index int `json:"index"`;                   // dataset index
+  Name string `json:"name"`;                   // path to dataset, or dataset_<index>
+  Records int `json:"records"`;               // #record
+  Field []*FieldProfile `json:"field"`;        // per field statistics
+}
+
+/* distinct values shared by a field of two datasets */
+type FieldOverlap struct {
+  Index int `json:"index"`;                   // field index
+  Name string `json:"name"`;                   // field name
+  A int `json:"a"`;                           // first dataset index
+  B int `json:"b"`;                           // second dataset index
+  Shared int `json:"shared"`;                 // #distinct value in both
+  Union int `json:"union"`;                   // #distinct value in either
+  Jaccard float64 `json:"jaccard"`;           // shared / union
+  CoverageA float64 `json:"coverage_a"`;      // ratio of present values in A also found in B
+  CoverageB float64 `json:"coverage_b"`;      // ratio of present values in B also found in A
+}
+
+/* profiling report of all datasets */
+type Profile struct {
+  Dataset []*DatasetProfile `json:"dataset"`;
+  Overlap []*FieldOverlap `json:"overlap"`;
+}
+
+/* profile datasets, top is the #most frequent values kept; datasets must be analyzed */
+func (cf *Config) Profile(top int) (*Profile, error) {
+  if !(*cf).analyzed {
+    return nil, ErrNotAnalyzed;
+  }
+  p := &Profile {
+    Dataset: make([]*DatasetProfile, (*cf).nd),
+  };
+  for i, d := range (*cf).dataset {
+    name := fmt.Sprintf("dataset_%d", i);
+    if i < len((*cf).path) {
+      name = (*cf).path[i];
+    }
+    (*p).Dataset[i] = &DatasetProfile {
+      Index: i,
+      Name: name,
+      Records: (*d).nr,
+      Field: make([]*FieldProfile, (*(*cf).Nf)),
+    };
+    for j := 0; j < (*(*cf).Nf); j++ {
+      (*(*p).Dataset[i]).Field[j] = d.profile_field(j, top, (*(*cf).Ng));
+    }
+  }
+  for i := 0; i < (*cf).nd; i++ {
+    for j := i + 1; j < (*cf).nd; j++ {
+      for k := 0; k < (*(*cf).Nf); k++ {
+        if !(*cf).ignore[k] {
+          (*p).Overlap = append((*p).Overlap, overlap((*cf).dataset[i], (*cf).dataset[j], i, j, k));
+        }
+      }
+    }
+  }
+  return p, nil;
+}
+
+/* statistics of a field */
+func (d *Dataset) profile_field(i, top, ng int) (*FieldProfile) {
+  meta := (*d).field[i];
+  f := &FieldProfile {
+    Index: i,
+    Name: (*meta).name,
+    Ignored: (*(*d).ignore)[i],
+    Total: int((*meta).total),
+    Missing: int((*meta).total - (*meta).exists),
+  };
+  if (*meta).total > 0 {
+    (*f).MissingRate = 1 - (*meta).exists / (*meta).total;
+  }
+  if (*f).Ignored {
+    return f;
+  }
+  (*f).Distinct = len((*meta).freq);
+  (*f).Entropy = (*meta).entropy;
+  (*f).Top = top_values((*meta).freq, top);
+  sum := 0;
+  for _, r := range (*d).record {
+    raw := (*(*r).field[i]).raw;
+    if raw == "n/a" {
+      continue;
+    }
+    n := len((*(*r).field[i]).ngram);
+    for len((*f).NgramHistogram) <= n {
+      (*f).NgramHistogram = append((*f).NgramHistogram, 0);
+    }
+    (*f).NgramHistogram[n]++;
+    sum += n;
+  }
+  if (*meta).exists > 0 {
+    (*f).AvgNgram = float64(sum) / (*meta).exists;
+  }
+  return f;
+}
+
+/* most frequent values, ties broken by value */
+func top_values(freq map[string]float64, top int) ([]ValueCount) {
+  values := make([]ValueCount, 0, len(freq));
+  for k, v := range freq {
+    values = append(values, ValueCount{k, int(v)});
+  }
+  sort.Slice(values, func(i, j int) (bool) {
+    if values[i].Count != values[j].Count {
+      return values[i].Count > values[j].Count;
+    }
+    return values[i].Value < values[j].Value;
+  });
+  if top >= 0 && len(values) > top {
+    values = values[:top];
+  }
+  return values;
+}
+
+/* value overlap of field k between datasets a and b */
+func overlap(a, b *Dataset, ia, ib, k int) (*FieldOverlap) {
+  fa := (*(*a).field[k]).freq;
+  fb := (*(*b).field[k]).freq;
+  o := &FieldOverlap {
+    Index: k,
+    Name: (*(*a).field[k]).name,
+    A: ia,
+    B: ib,
+  };
+  covered_a := float64(0);
+  covered_b := float64(0);
+  for v, cnt := range fa {
+    if cnt_b, ok := fb[v]; ok {
+      (*o).Shared++;
+      covered_a += cnt;
+      covered_b += cnt_b;
+    }
+  }
+  (*o).Union = len(fa) + len(fb) - (*o).Shared;
+  if (*o).Union > 0 {
+    (*o).Jaccard = float64((*o).Shared) / float64((*o).Union);
+  }
+  if (*(*a).field[k]).exists > 0 {
+    (*o).CoverageA = covered_a / (*(*a).field[k]).exists;
+  }
+  if (*(*b).field[k]).exists > 0 {
+    (*o).CoverageB = covered_b / (*(*b).field[k]).exists;
+  }
+  return o;
+}
+
+/* display profile as tables */
+func (p *Profile) Print(w io.Writer) {
+  for _, d := range (*p).Dataset {
+    fmt.Fprintf(w, "dataset %d (%s): %d records\n", (*d).Index, (*d).Name, (*d).Records);
+    fmt.Fprintf(w, "%4s %-20s %8s %9s %8s %9s  %s\n", "idx", "name", "missing", "distinct", "entropy", "avg_ngram", "top values");
+    for _, f := range (*d).Field {
+      if (*f).Ignored {
+        fmt.Fprintf(w, "%4d %-20s %7.2f%% %9s %8s %9s  (ignored)\n", (*f).Index, (*f).Name, (*f).MissingRate * 100, "-", "-", "-");
+        continue;
+      }
+      top := make([]string, len((*f).Top));
+      for i, v := range (*f).Top {
+        top[i] = fmt.Sprintf("%s(%d)", v.Value, v.Count);
+      }
+      fmt.Fprintf(w, "%4d %-20s %7.2f%% %9d %8.4f %9.2f  %s\n", (*f).Index, (*f).Name, (*f).MissingRate * 100, (*f).Distinct, (*f).Entropy, (*f).AvgNgram, strings.Join(top, " "));
+    }
+    fmt.Fprintf(w, "n-gram histogram (#n-gram:#record)\n");
+    for _, f := range (*d).Field {
+      if (*f).Ignored {
+        continue;
+      }
+      hist := make([]string, 0, len((*f).NgramHistogram));
+      for n, cnt := range (*f).NgramHistogram {
+        if cnt > 0 {
+          hist = append(hist, fmt.Sprintf("%d:%d", n, cnt));
+        }
+      }
+      fmt.Fprintf(w, "%4d %-20s %s\n", (*f).Index, (*f).Name, strings.Join(hist, " "));
+    }
+    fmt.Fprintf(w, "\n");
+  }
+  if len((*p).Overlap) == 0 {
+    return;
+  }
+  fmt.Fprintf(w, "cross-dataset overlap\n");
+  fmt.Fprintf(w, "%5s %4s %-20s %8s %8s %8s %10s %10s\n", "a-b", "idx", "name", "shared", "union", "jaccard", "coverage_a", "coverage_b");
+  for _, o := range (*p).Overlap {
+    fmt.Fprintf(w, "%5s %4d %-20s %8d %8d %8.4f %10.4f %10.4f\n", fmt.Sprintf("%d-%d", (*o).A, (*o).B), (*o).Index, (*o).Name, (*o).Shared, (*o).Union, (*o).Jaccard, (*o).CoverageA, (*o).CoverageB);
+  }
+}
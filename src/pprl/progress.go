@@ -0,0 +1,106 @@
+package pprl;
+
+import "sync";
+import "sync/atomic";
+import "time";
+
+/* processing stages reported through progress */
+const StageLoad = "load";
+const StageEntropy = "entropy";
+const StageNgram = "ngram";
+const StageIndex = "index";
+const StageEncode = "encode";
+const StageCompare = "compare";
+
+/* snapshot of a running stage */
+type Progress struct {
+  Stage string;                 // stage name
+  Dataset int;                  // dataset index, -1 if the stage covers more than one dataset
+  Done int64;                   // #record processed
+  Total int64;                  // #record of the stage, 0 if unknown
+  Elapsed time.Duration;        // time since the stage started
+  ETA time.Duration;            // estimated remaining time, 0 if unknown
+}
+
+/* progress callback, called from worker go routines but never concurrently */
+type ProgressFunc func(p Progress);
+
+/* #report per stage */
+const _progress_step = 100;
+
+/* #record counted locally by a worker before it is added to a tracker */
+const _progress_batch = 4096;
+
+/* progress counter of a stage */
+type progress_tracker struct {
+  stage string;
+  dataset int;
+  total int64;
+  done int64;                   // updated atomically
+  step int64;                   // report every step records
+  next int64;                   // next report point
+  start time.Time;
+  fn ProgressFunc;
+  lock sync.Mutex;
+}
+
+/* set progress callback, nil to disable */
+func (cf *Config) SetProgress(fn ProgressFunc) {
+  (*cf).progress = fn;
+}
+
+/* start tracking a stage, fn can be nil */
+func new_progress(fn ProgressFunc, stage string, dataset int, total int64) (*progress_tracker) {
+  step := total / _progress_step;
+  if step <= 0 {
+    step = 1;
+  }
+  p := &progress_tracker {
+    stage: stage,
+    dataset: dataset,
+    total: total,
+    step: step,
+    next: step,
+    start: time.Now(),
+    fn: fn,
+  };
+  p.report(0);
+  return p;
+}
+
+/* mark n more records done */
+func (p *progress_tracker) add(n int64) {
+  if p == nil || (*p).fn == nil {
+    return;
+  }
+  done := atomic.AddInt64(&(*p).done, n);
+  (*p).lock.Lock();
+  defer (*p).lock.Unlock();
+  if done < (*p).next && done != (*p).total {
+    return;
+  }
+  for (*p).next <= done {
+    (*p).next += (*p).step;
+  }
+  p.report(done);
+}
+
+/* call the callback with current state */
+func (p *progress_tracker) report(done int64) {
+  if (*p).fn == nil {
+    return;
+  }
+  elapsed := time.Since((*p).start);
+  eta := time.Duration(0);
+  if done > 0 && (*p).total > done {
+    eta = time.Duration(float64(elapsed) / float64(done) * float64((*p).total - done));
+  }
+  (*p).fn(Progress {
+    Stage: (*p).stage,
+    Dataset: (*p).dataset,
+    Done: done,
+    Total: (*p).total,
+    Elapsed: elapsed,
+    ETA: eta,
+  });
+}
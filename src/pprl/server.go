@@ -0,0 +1,761 @@
+package pprl;
+
+import "bufio";
+import "context";
+import "crypto/rand";
+import "crypto/sha256";
+import "crypto/subtle";
+import "encoding/hex";
+import "encoding/json";
+import "fmt";
+import "io";
+import "net/http";
+import "os";
+import "path/filepath";
+import "strconv";
+import "strings";
+import "sync";
+
+/*
+  linkage unit, custodians upload encoded records and fetch their part of the result:
+
+    POST /projects                                     create, returns id and party tokens
+    GET  /projects/{id}                                status of the project and uploads
+    PUT  /projects/{id}/parties/{party}/filters?offset= append a chunk at byte offset
+    POST /projects/{id}/parties/{party}/complete?sha256= finish an upload
+    PUT  /projects/{id}/parties/{party}/stream          upload and finish in one stream, see NewStreamReader
+    POST /projects/{id}/match                          start linkage once all uploads are done
+    GET  /projects/{id}/parties/{party}/results        clusters holding records of the party
+
+  project requests take the admin token if set, the others a token of the
+  project, party paths only the token of that party
+*/
+
+/* project states */
+const ProjectUploading = "uploading";
+const ProjectMatching = "matching";
+const ProjectDone = "done";
+const ProjectFailed = "failed";
+
+/* linkage unit parameters */
+type ServerOption struct {
+  Dir string;                   // directory of uploads, a temporary one if empty
+  AdminToken string;            // token to create projects, anyone may if empty
+  MaxChunk int64;               // max #byte of an upload request, 0 for default
+  Worker int;                   // #worker for comparison, 0 for GOMAXPROCS
+}
+
+/* body of project creation */
+type ProjectRequest struct {
+  Parties []string `json:"parties"`;       // party names, at least 2
+  Threshold *float64 `json:"threshold"`;   // minimum dice coefficient of a match
+  BlockBit *int `json:"block_bit"`;        // #bit sampled for a block key
+  BlockIter *int `json:"block_iter"`;      // #blocking iteration
+  BlockSeed int64 `json:"block_seed"`;     // seed for sampling block bits
+  Assign string `json:"assign"`;           // one-to-one assignment between each pair of parties
+}
+
+/* reply of project creation, tokens are only told once */
+type ProjectResponse struct {
+  Id string `json:"id"`;
+  Tokens map[string]string `json:"tokens"`; // party to upload token
+}
+
+/* state of a project */
+type ProjectStatus struct {
+  Id string `json:"id"`;
+  State string `json:"state"`;
+  Error string `json:"error,omitempty"`;   // reason of failure
+  Party map[string]*PartyStatus `json:"party"`;
+  Clusters int `json:"clusters"`;          // #cluster once done
+}
+
+/* upload of a party */
+type PartyStatus struct {
+  Size int64 `json:"size"`;                // #byte received, the offset of the next chunk
+  Complete bool `json:"complete"`;         // upload finished and parsed
+  Count int `json:"count"`;                 // #record once complete
+  Sha256 string `json:"sha256,omitempty"`;  // hash of the upload once complete
+}
+
+/* linkage unit */
+type Server struct {
+  opt ServerOption;
+  mutex sync.Mutex;             // guards project and project states, uploads have their own
+  project map[string]*project;
+  ctx context.Context;          // cancelled by Close, stops matching
+  cancel context.CancelFunc;
+  matching sync.WaitGroup;      // running matches, which read the uploads
+  closed bool;                  // no more matches start
+  temp bool;                    // Dir was created by the server
+}
+
+type project struct {
+  id string;
+  dir string;                   // uploads of the project
+  parties []string;             // party names in request order
+  token map[string]string;      // party to token
+  upload map[string]*upload;    // party to upload
+  opt *CompareOption;
+  state string;
+  err string;
+  result *LinkResult;
+}
+
+/*
+  upload of a party; the mutex is only held to read or change these fields,
+  never over network or file I/O, which is claimed with receiving or
+  finishing instead so that status polls do not wait on a slow uploader
+*/
+type upload struct {
+  mutex sync.Mutex;             // guards the upload, taken after Server.mutex
+  receiving bool;               // a chunk or stream is being written
+  finishing bool;               // being parsed by finish, no chunks are taken meanwhile
+  status PartyStatus;
+  meta *Meta;
+  filters []*Filter;
+  binary *BinaryFile;           // mapping backing filters, if uploaded as binary
+}
+
+/* default linkage unit configs */
+const _default_max_chunk = 64 << 20;
+const _token_bytes = 16;
+
+/* linkage unit with uploads under opt.Dir */
+func NewServer(opt ServerOption) (*Server, error) {
+  s := &Server {
+    opt: opt,
+    project: make(map[string]*project),
+  };
+  if (*s).opt.MaxChunk <= 0 {
+    (*s).opt.MaxChunk = _default_max_chunk;
+  }
+  if (*s).opt.Dir == "" {
+    dir, err := os.MkdirTemp("", "pprl-lu-");
+    if err != nil {
+      return nil, err;
+    }
+    (*s).opt.Dir = dir;
+    (*s).temp = true;
+  } else if err := os.MkdirAll((*s).opt.Dir, 0700); err != nil {
+    return nil, err;
+  }
+  (*s).ctx, (*s).cancel = context.WithCancel(context.Background());
+  return s, nil;
+}
+
+/* route a request, path parameters are passed along */
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  part := strings.Split(strings.Trim((*r).URL.Path, "/"), "/");
+  if len(part) == 0 || part[0] != "projects" {
+    http_error(w, http.StatusNotFound, "not found");
+    return;
+  }
+  route := func(method string, handler func(http.ResponseWriter, *http.Request, string, string), id, party string) {
+    if (*r).Method != method {
+      w.Header().Set("Allow", method);
+      http_error(w, http.StatusMethodNotAllowed, "method not allowed");
+      return;
+    }
+    handler(w, r, id, party);
+  };
+  switch {
+  case len(part) == 1:
+    route(http.MethodPost, s.create, "", "");
+  case len(part) == 2:
+    route(http.MethodGet, s.status, part[1], "");
+  case len(part) == 3 && part[2] == "match":
+    route(http.MethodPost, s.match, part[1], "");
+  case len(part) == 5 && part[2] == "parties" && part[4] == "filters":
+    route(http.MethodPut, s.put_filters, part[1], part[3]);
+  case len(part) == 5 && part[2] == "parties" && part[4] == "stream":
+    route(http.MethodPut, s.stream, part[1], part[3]);
+  case len(part) == 5 && part[2] == "parties" && part[4] == "complete":
+    route(http.MethodPost, s.complete, part[1], part[3]);
+  case len(part) == 5 && part[2] == "parties" && part[4] == "results":
+    route(http.MethodGet, s.results, part[1], part[3]);
+  default:
+    http_error(w, http.StatusNotFound, "not found");
+  }
+}
+
+/* stop matching and release uploads, a temporary directory is removed */
+func (s *Server) Close() (error) {
+  (*s).mutex.Lock();
+  (*s).closed = true;
+  (*s).mutex.Unlock();
+  /* running matches read mapped uploads, they are done before unmapping */
+  (*s).cancel();
+  (*s).matching.Wait();
+  (*s).mutex.Lock();
+  defer (*s).mutex.Unlock();
+  for _, p := range (*s).project {
+    for _, u := range (*p).upload {
+      if (*u).binary != nil {
+        (*u).binary.Close();
+      }
+    }
+  }
+  if (*s).temp {
+    return os.RemoveAll((*s).opt.Dir);
+  }
+  return nil;
+}
+
+/* POST /projects */
+func (s *Server) create(w http.ResponseWriter, r *http.Request, _, _ string) {
+  if (*s).opt.AdminToken != "" && !token_equal(bearer(r), (*s).opt.AdminToken) {
+    http_error(w, http.StatusUnauthorized, "invalid admin token");
+    return;
+  }
+  var req ProjectRequest;
+  decoder := json.NewDecoder(http.MaxBytesReader(w, (*r).Body, 1 << 20));
+  decoder.DisallowUnknownFields();
+  if err := decoder.Decode(&req); err != nil {
+    http_error(w, http.StatusBadRequest, err.Error());
+    return;
+  }
+  if len(req.Parties) < 2 {
+    http_error(w, http.StatusBadRequest, ErrCompareDataset.Error());
+    return;
+  }
+  seen := make(map[string]bool);
+  for _, name := range req.Parties {
+    if name == "" || seen[name] || strings.ContainsAny(name, "/\\.") {
+      http_error(w, http.StatusBadRequest, "party names should be distinct, non-empty and without / \\ .");
+      return;
+    }
+    seen[name] = true;
+  }
+  if err := check_assign(req.Assign); err != nil {
+    http_error(w, http.StatusBadRequest, err.Error());
+    return;
+  }
+  opt := NewCompareOption(0);
+  if (*s).opt.Worker > 0 {
+    (*opt).Worker = (*s).opt.Worker;
+  }
+  if req.Threshold != nil {
+    (*opt).Threshold = (*req.Threshold);
+  }
+  if req.BlockBit != nil {
+    (*opt).Blk = (*req.BlockBit);
+  }
+  if req.BlockIter != nil {
+    (*opt).Iter = (*req.BlockIter);
+  }
+  (*opt).Seed = req.BlockSeed;
+  (*opt).Assign = req.Assign;
+  p := &project {
+    id: random_hex(8),
+    parties: req.Parties,
+    token: make(map[string]string),
+    upload: make(map[string]*upload),
+    opt: opt,
+    state: ProjectUploading,
+  };
+  (*p).dir = filepath.Join((*s).opt.Dir, (*p).id);
+  if err := os.MkdirAll((*p).dir, 0700); err != nil {
+    http_error(w, http.StatusInternalServerError, err.Error());
+    return;
+  }
+  resp := &ProjectResponse {
+    Id: (*p).id,
+    Tokens: make(map[string]string),
+  };
+  for _, name := range req.Parties {
+    (*p).token[name] = random_hex(_token_bytes);
+    (*p).upload[name] = &upload{};
+    (*resp).Tokens[name] = (*p).token[name];
+  }
+  (*s).mutex.Lock();
+  (*s).project[(*p).id] = p;
+  (*s).mutex.Unlock();
+  write_json(w, http.StatusCreated, resp);
+}
+
+/* GET /projects/{id} */
+func (s *Server) status(w http.ResponseWriter, r *http.Request, id, _ string) {
+  (*s).mutex.Lock();
+  p, ok := s.authorize(w, r, id, "");
+  if !ok {
+    (*s).mutex.Unlock();
+    return;
+  }
+  st := p.status();
+  (*s).mutex.Unlock();
+  write_json(w, http.StatusOK, st);
+}
+
+/* PUT /projects/{id}/parties/{party}/filters?offset=, appends the body if offset equals the received size */
+func (s *Server) put_filters(w http.ResponseWriter, r *http.Request, id, party string) {
+  offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64);
+  if err != nil || offset < 0 {
+    http_error(w, http.StatusBadRequest, "invalid offset");
+    return;
+  }
+  (*s).mutex.Lock();
+  p, ok := s.authorize(w, r, id, party);
+  (*s).mutex.Unlock();
+  if !ok {
+    return;
+  }
+  /* chunks of a party are appended one at a time, the body is read without the lock */
+  u := (*p).upload[party];
+  (*u).mutex.Lock();
+  st := (*u).status;
+  busy := (*u).status.Complete || (*u).finishing || (*u).receiving;
+  if !busy && offset == (*u).status.Size {
+    (*u).receiving = true;
+  }
+  (*u).mutex.Unlock();
+  if busy || offset != st.Size {
+    /* the client resumes from the size told here */
+    write_json(w, http.StatusConflict, &st);
+    return;
+  }
+  n, err := write_chunk(p.path(party), offset, http.MaxBytesReader(w, (*r).Body, (*s).opt.MaxChunk));
+  (*u).mutex.Lock();
+  (*u).receiving = false;
+  if err == nil {
+    (*u).status.Size += n;
+  }
+  st = (*u).status;
+  (*u).mutex.Unlock();
+  if err != nil {
+    http_error(w, http.StatusBadRequest, err.Error());
+    return;
+  }
+  write_json(w, http.StatusOK, &st);
+}
+
+/* write r to path at offset, a partial chunk is dropped so that the next one starts from offset again */
+func write_chunk(path string, offset int64, r io.Reader) (int64, error) {
+  fp, err := os.OpenFile(path, os.O_WRONLY | os.O_CREATE, 0600);
+  if err != nil {
+    return 0, err;
+  }
+  defer fp.Close();
+  if _, err = fp.Seek(offset, io.SeekStart); err != nil {
+    return 0, err;
+  }
+  n, err := io.Copy(fp, r);
+  if err != nil {
+    fp.Truncate(offset);
+    return 0, err;
+  }
+  return n, nil;
+}
+
+/* POST /projects/{id}/parties/{party}/complete?sha256=, parses the upload */
+func (s *Server) complete(w http.ResponseWriter, r *http.Request, id, party string) {
+  s.finish(w, r, id, party, r.URL.Query().Get("sha256"));
+}
+
+/*
+  PUT /projects/{id}/parties/{party}/stream, receives the records as a stream
+  (see NewStreamReader) in place of chunked uploads; the reply to a stream
+  that fails verification is an error frame, otherwise the party status
+*/
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, id, party string) {
+  (*s).mutex.Lock();
+  p, ok := s.authorize(w, r, id, party);
+  (*s).mutex.Unlock();
+  if !ok {
+    return;
+  }
+  u := (*p).upload[party];
+  (*u).mutex.Lock();
+  st := (*u).status;
+  busy := (*u).status.Complete || (*u).finishing || (*u).receiving;
+  if !busy {
+    (*u).receiving = true;
+  }
+  (*u).mutex.Unlock();
+  if busy {
+    write_json(w, http.StatusConflict, &st);
+    return;
+  }
+  /* a stream replaces a partial chunked upload, it is received without the lock */
+  size, err := receive_upload(p.path(party), (*r).Body);
+  (*u).mutex.Lock();
+  (*u).receiving = false;
+  (*u).status.Size = size;
+  /* straight on to finish, so that no chunk slips in before it */
+  (*u).finishing = err == nil;
+  (*u).mutex.Unlock();
+  if err != nil {
+    w.Header().Set("Content-Type", "application/octet-stream");
+    w.WriteHeader(http.StatusUnprocessableEntity);
+    WriteStreamAck(w, nil, err);
+    return;
+  }
+  /* the stream is verified by its manifest, the file hash is only recorded */
+  s.publish(w, p, party, "");
+}
+
+/* write a stream to path as encoded output, returns its size; a failed one leaves the file empty */
+func receive_upload(path string, r io.Reader) (int64, error) {
+  fp, err := os.Create(path);
+  if err != nil {
+    return 0, err;
+  }
+  _, _, err = ReceiveStream(r, fp);
+  if err == nil {
+    err = fp.Close();
+  } else {
+    fp.Close();
+  }
+  if err != nil {
+    os.Truncate(path, 0);
+    return 0, err;
+  }
+  info, err := os.Stat(path);
+  if err != nil {
+    return 0, err;
+  }
+  return info.Size(), nil;
+}
+
+/* parse the upload of a party and check it against the others, want is its sha256 if not empty */
+func (s *Server) finish(w http.ResponseWriter, r *http.Request, id, party, want string) {
+  (*s).mutex.Lock();
+  p, ok := s.authorize(w, r, id, party);
+  (*s).mutex.Unlock();
+  if !ok {
+    return;
+  }
+  u := (*p).upload[party];
+  (*u).mutex.Lock();
+  if (*u).status.Complete {
+    st := (*u).status;
+    (*u).mutex.Unlock();
+    write_json(w, http.StatusOK, &st);
+    return;
+  }
+  if (*u).finishing || (*u).receiving {
+    st := (*u).status;
+    (*u).mutex.Unlock();
+    write_json(w, http.StatusConflict, &st);
+    return;
+  }
+  (*u).finishing = true;
+  (*u).mutex.Unlock();
+  s.publish(w, p, party, want);
+}
+
+/*
+  read an upload claimed by finishing and make it complete; the upload is
+  read without any lock held, and Server.mutex is only taken to compare
+  schemas and publish
+*/
+func (s *Server) publish(w http.ResponseWriter, p *project, party, want string) {
+  u := (*p).upload[party];
+  meta, filters, binary, sum, code, err := read_upload(p.path(party), want);
+  if err != nil {
+    (*u).mutex.Lock();
+    (*u).finishing = false;
+    (*u).mutex.Unlock();
+    http_error(w, code, err.Error());
+    return;
+  }
+  /* all parties must use the same schema */
+  schema := SchemaHash(meta);
+  (*s).mutex.Lock();
+  differ := "";
+  for name, other := range (*p).upload {
+    if name == party {
+      continue;
+    }
+    (*other).mutex.Lock();
+    if (*other).status.Complete && SchemaHash((*other).meta) != schema {
+      differ = name;
+    }
+    (*other).mutex.Unlock();
+    if differ != "" {
+      break;
+    }
+  }
+  (*u).mutex.Lock();
+  (*u).finishing = false;
+  if differ == "" {
+    (*u).meta = meta;
+    (*u).filters = filters;
+    (*u).binary = binary;
+    (*u).status.Complete = true;
+    (*u).status.Count = len(filters);
+    (*u).status.Sha256 = sum;
+  }
+  st := (*u).status;
+  (*u).mutex.Unlock();
+  (*s).mutex.Unlock();
+  if differ != "" {
+    if binary != nil {
+      binary.Close();
+    }
+    http_error(w, http.StatusUnprocessableEntity, fmt.Sprintf("schema differs from party %s", differ));
+    return;
+  }
+  write_json(w, http.StatusOK, &st);
+}
+
+/* hash, parse and check an upload, with the status code of a failure */
+func read_upload(path, want string) (*Meta, []*Filter, *BinaryFile, string, int, error) {
+  sum, err := file_sha256(path);
+  if err != nil {
+    return nil, nil, nil, "", http.StatusBadRequest, Error("nothing uploaded");
+  }
+  if want != "" && !strings.EqualFold(want, sum) {
+    return nil, nil, nil, "", http.StatusUnprocessableEntity, Error("sha256 of upload differs, got " + sum);
+  }
+  meta, filters, binary, err := open_filters(path);
+  if err == nil {
+    err = check_upload(meta, filters);
+  }
+  if err != nil {
+    if binary != nil {
+      binary.Close();
+    }
+    return nil, nil, nil, "", http.StatusUnprocessableEntity, err;
+  }
+  return meta, filters, binary, sum, http.StatusOK, nil;
+}
+
+/* records of an upload fit its metadata, so that no bad row reaches comparison */
+func check_upload(meta *Meta, filters []*Filter) (error) {
+  if (*meta).Mb <= 0 || (*meta).Count < 0 || (*meta).Count != len(filters) {
+    return ErrFilterFormat;
+  }
+  row := ((*meta).Mb + 7) / 8;
+  for _, f := range filters {
+    if len((*f).Bits) != row {
+      return ErrFilterFormat;
+    }
+  }
+  return nil;
+}
+
+/* POST /projects/{id}/match, links in the background */
+func (s *Server) match(w http.ResponseWriter, r *http.Request, id, _ string) {
+  (*s).mutex.Lock();
+  defer (*s).mutex.Unlock();
+  p, ok := s.authorize(w, r, id, "");
+  if !ok {
+    return;
+  }
+  if (*p).state == ProjectMatching || (*p).state == ProjectDone {
+    write_json(w, http.StatusAccepted, p.status());
+    return;
+  }
+  if (*s).closed {
+    http_error(w, http.StatusServiceUnavailable, "server is shutting down");
+    return;
+  }
+  sets := make([][]*Filter, len((*p).parties));
+  for i, name := range (*p).parties {
+    u := (*p).upload[name];
+    (*u).mutex.Lock();
+    complete := (*u).status.Complete;
+    if complete {
+      sets[i] = (*u).filters;
+      (*(*p).opt).Mb = (*(*u).meta).Mb;
+    }
+    (*u).mutex.Unlock();
+    if !complete {
+      http_error(w, http.StatusConflict, "upload of party " + name + " is not complete");
+      return;
+    }
+  }
+  (*p).state = ProjectMatching;
+  (*p).err = "";
+  opt := *(*p).opt;
+  (*s).matching.Add(1);
+  go func() {
+    defer (*s).matching.Done();
+    result, err := link_recover((*s).ctx, sets, &opt);
+    (*s).mutex.Lock();
+    defer (*s).mutex.Unlock();
+    if err != nil {
+      (*p).state = ProjectFailed;
+      (*p).err = err.Error();
+      return;
+    }
+    (*p).result = result;
+    (*p).state = ProjectDone;
+  }();
+  write_json(w, http.StatusAccepted, p.status());
+}
+
+/* Link with a panic turned into an error, so that one project cannot take down the server */
+func link_recover(ctx context.Context, sets [][]*Filter, opt *CompareOption) (result *LinkResult, err error) {
+  defer func() {
+    if r := recover(); r != nil {
+      result, err = nil, fmt.Errorf("linkage failed: %v", r);
+    }
+  } ();
+  return Link(ctx, sets, opt);
+}
+
+/* GET /projects/{id}/parties/{party}/results, "cluster,id,line,confidence" lines of the party's records */
+func (s *Server) results(w http.ResponseWriter, r *http.Request, id, party string) {
+  (*s).mutex.Lock();
+  p, ok := s.authorize(w, r, id, party);
+  if !ok {
+    (*s).mutex.Unlock();
+    return;
+  }
+  if (*p).state != ProjectDone {
+    code := http.StatusConflict;
+    if (*p).state == ProjectMatching {
+      code = http.StatusAccepted;
+    }
+    st := p.status();
+    (*s).mutex.Unlock();
+    write_json(w, code, st);
+    return;
+  }
+  /* a result is not changed once done, it is written without the lock */
+  result := (*p).result;
+  index := 0;
+  for i, name := range (*p).parties {
+    if name == party {
+      index = i;
+    }
+  }
+  (*s).mutex.Unlock();
+  w.Header().Set("Content-Type", "text/csv");
+  bw := bufio.NewWriter(w);
+  for _, c := range (*result).Cluster {
+    for _, m := range (*c).Member {
+      if (*m).Dataset == index {
+        fmt.Fprintf(bw, "%d,%s,%d,%.6f\n", (*c).Id, escape_id((*m).Id), (*m).Line, (*c).Confidence);
+      }
+    }
+  }
+  bw.Flush();
+}
+
+/* project of the request if the token fits, party tokens only open their own party */
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, id, party string) (*project, bool) {
+  p, ok := (*s).project[id];
+  if !ok {
+    http_error(w, http.StatusNotFound, "no such project");
+    return nil, false;
+  }
+  token := bearer(r);
+  if party != "" {
+    want, ok := (*p).token[party];
+    if !ok {
+      http_error(w, http.StatusNotFound, "no such party");
+      return nil, false;
+    }
+    if !token_equal(token, want) {
+      http_error(w, http.StatusUnauthorized, "invalid party token");
+      return nil, false;
+    }
+    return p, true;
+  }
+  if (*s).opt.AdminToken != "" && token_equal(token, (*s).opt.AdminToken) {
+    return p, true;
+  }
+  for _, want := range (*p).token {
+    if token_equal(token, want) {
+      return p, true;
+    }
+  }
+  http_error(w, http.StatusUnauthorized, "invalid token");
+  return nil, false;
+}
+
+/* status snapshot, called with the lock held */
+func (p *project) status() (*ProjectStatus) {
+  st := &ProjectStatus {
+    Id: (*p).id,
+    State: (*p).state,
+    Error: (*p).err,
+    Party: make(map[string]*PartyStatus),
+  };
+  for name, u := range (*p).upload {
+    (*u).mutex.Lock();
+    ps := (*u).status;
+    (*u).mutex.Unlock();
+    (*st).Party[name] = &ps;
+  }
+  if (*p).result != nil {
+    (*st).Clusters = len((*(*p).result).Cluster);
+  }
+  return st;
+}
+
+/* path to the upload of a party */
+func (p *project) path(party string) (string) {
+  return filepath.Join((*p).dir, party + ".enc");
+}
+
+/* encoded records from a file, text or binary; binary ones stay mapped */
+func open_filters(path string) (*Meta, []*Filter, *BinaryFile, error) {
+  fp, err := os.Open(path);
+  if err != nil {
+    return nil, nil, nil, err;
+  }
+  defer fp.Close();
+  r := bufio.NewReader(fp);
+  if IsBinary(r) {
+    b, err := OpenBinary(path);
+    if err != nil {
+      return nil, nil, nil, err;
+    }
+    return (*b).Meta, b.Filters(), b, nil;
+  }
+  meta, filters, err := ReadFilters(r);
+  return meta, filters, nil, err;
+}
+
+/* hex sha256 of a file */
+func file_sha256(path string) (string, error) {
+  fp, err := os.Open(path);
+  if err != nil {
+    return "", err;
+  }
+  defer fp.Close();
+  h := sha256.New();
+  if _, err = io.Copy(h, fp); err != nil {
+    return "", err;
+  }
+  return hex.EncodeToString(h.Sum(nil)), nil;
+}
+
+/* token of "Authorization: Bearer <token>" */
+func bearer(r *http.Request) (string) {
+  auth := (*r).Header.Get("Authorization");
+  if !strings.HasPrefix(auth, "Bearer ") {
+    return "";
+  }
+  return strings.TrimSpace(auth[len("Bearer "):]);
+}
+
+/* compare tokens in constant time, empty tokens never match */
+func token_equal(a, b string) (bool) {
+  return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1;
+}
+
+/* n random bytes in hex */
+func random_hex(n int) (string) {
+  b := make([]byte, n);
+  if _, err := rand.Read(b); err != nil {
+    panic(err);
+  }
+  return hex.EncodeToString(b);
+}
+
+/* reply with a JSON body */
+func write_json(w http.ResponseWriter, code int, v interface{}) {
+  w.Header().Set("Content-Type", "application/json");
+  w.WriteHeader(code);
+  json.NewEncoder(w).Encode(v);
+}
+
+/* reply with {"error": msg} */
+func http_error(w http.ResponseWriter, code int, msg string) {
+  write_json(w, code, map[string]string{"error": msg});
+}
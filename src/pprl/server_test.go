@@ -0,0 +1,157 @@
+package pprl;
+
+import "bytes";
+import "context";
+import "crypto/sha256";
+import "encoding/hex";
+import "errors";
+import "math/rand";
+import "net/http";
+import "net/http/httptest";
+import "strconv";
+import "strings";
+import "testing";
+import "time";
+
+/* encoded records of a party, the first shared records are equal in both parties */
+func test_upload(t *testing.T, seed int64, shared, count int) ([]byte) {
+  meta := &Meta {
+    Mb: 256,
+    Ngram: 2,
+    K: []int{8},
+    Field: []string{"name"},
+    Count: count,
+    Seed: SeedPrefix,
+  };
+  common := rand.New(rand.NewSource(1));
+  own := rand.New(rand.NewSource(seed));
+  filters := make([]*Filter, count);
+  for i := range filters {
+    bits := make([]byte, 32);
+    if i < shared {
+      common.Read(bits);
+    } else {
+      own.Read(bits);
+    }
+    filters[i] = &Filter{strconv.Itoa(i), i + 2, bits};
+  }
+  var buf bytes.Buffer;
+  if err := WriteFilters(&buf, meta, filters); err != nil {
+    t.Fatal(err);
+  }
+  return buf.Bytes();
+}
+
+/* status code of a request, or of the HTTPError it failed with */
+func status_code(err error) (int) {
+  var e *HTTPError;
+  if errors.As(err, &e) {
+    return (*e).Code;
+  }
+  if err != nil {
+    return -1;
+  }
+  return http.StatusOK;
+}
+
+func TestServer(t *testing.T) {
+  s, err := NewServer(ServerOption{AdminToken: "admin", Worker: 2});
+  if err != nil {
+    t.Fatal(err);
+  }
+  ts := httptest.NewServer(s);
+  defer s.Close();
+  defer ts.Close();
+  ctx := context.Background();
+  client := func(token string) (*Client) {
+    c := NewClient((*ts).URL, token);
+    (*c).Retry = 0;
+    (*c).Chunk = 1024;
+    return c;
+  };
+
+  /* create */
+  req := &ProjectRequest{Parties: []string{"a", "b"}};
+  if _, err = client("wrong").CreateProject(ctx, req); status_code(err) != http.StatusUnauthorized {
+    t.Fatalf("create with a wrong admin token: %v", err);
+  }
+  resp, err := client("admin").CreateProject(ctx, req);
+  if err != nil {
+    t.Fatal(err);
+  }
+  id := (*resp).Id;
+  a := client((*resp).Tokens["a"]);
+  b := client((*resp).Tokens["b"]);
+
+  /* token rejection */
+  if _, err = client("wrong").Status(ctx, id); status_code(err) != http.StatusUnauthorized {
+    t.Fatalf("status with a wrong token: %v", err);
+  }
+  data_a := test_upload(t, 2, 20, 50);
+  if _, err = b.Upload(ctx, id, "a", bytes.NewReader(data_a), int64(len(data_a))); status_code(err) != http.StatusUnauthorized {
+    t.Fatalf("upload with the token of another party: %v", err);
+  }
+
+  /* a chunk at a wrong offset is told where to resume */
+  path := "/projects/" + id + "/parties/a";
+  if _, err = a.call(ctx, http.MethodPut, path + "/filters?offset=0", data_a[:100], nil); err != nil {
+    t.Fatal(err);
+  }
+  st := &PartyStatus{};
+  code, err := a.call(ctx, http.MethodPut, path + "/filters?offset=0", data_a[:100], st);
+  if code != http.StatusConflict || (*st).Size != 100 {
+    t.Fatalf("chunk at a wrong offset: %d %v, size %d", code, err, (*st).Size);
+  }
+  /* Upload resumes from there */
+  ps, err := a.Upload(ctx, id, "a", bytes.NewReader(data_a), int64(len(data_a)));
+  if err != nil {
+    t.Fatal(err);
+  }
+  sum := sha256.Sum256(data_a);
+  if !(*ps).Complete || (*ps).Count != 50 || (*ps).Sha256 != hex.EncodeToString(sum[:]) {
+    t.Fatalf("resumed upload: %+v", *ps);
+  }
+
+  /* complete with a sha256 that does not fit */
+  data_b := test_upload(t, 3, 20, 40);
+  if _, err = b.call(ctx, http.MethodPut, "/projects/" + id + "/parties/b/filters?offset=0", data_b, nil); err != nil {
+    t.Fatal(err);
+  }
+  if _, err = b.call(ctx, http.MethodPost, "/projects/" + id + "/parties/b/complete?sha256=" + strings.Repeat("0", 64), nil, nil); status_code(err) != http.StatusUnprocessableEntity {
+    t.Fatalf("complete with a wrong sha256: %v", err);
+  }
+  if _, err = a.Match(ctx, id); status_code(err) != http.StatusConflict {
+    t.Fatalf("match before all uploads: %v", err);
+  }
+  if ps, err = b.Upload(ctx, id, "b", bytes.NewReader(data_b), int64(len(data_b))); err != nil || !(*ps).Complete {
+    t.Fatalf("upload of b: %v", err);
+  }
+
+  /* match and results */
+  if _, err = a.Match(ctx, id); err != nil {
+    t.Fatal(err);
+  }
+  wait, cancel := context.WithTimeout(ctx, 30 * time.Second);
+  defer cancel();
+  if _, err = a.Wait(wait, id, 10 * time.Millisecond); err != nil {
+    t.Fatal(err);
+  }
+  var out bytes.Buffer;
+  if err = a.Results(ctx, id, "a", &out); err != nil {
+    t.Fatal(err);
+  }
+  /* clusters hold exactly the shared records, ids 0 to 19 */
+  lines := strings.Split(strings.TrimSpace(out.String()), "\n");
+  if len(lines) != 20 {
+    t.Fatalf("%d result lines, expected 20", len(lines));
+  }
+  for _, line := range lines {
+    column := strings.Split(line, ",");
+    if n, err := strconv.Atoi(column[1]); len(column) != 4 || err != nil || n >= 20 {
+      t.Fatalf("unexpected result line %q", line);
+    }
+  }
+  if err = a.Results(ctx, id, "b", &out); status_code(err) != http.StatusUnauthorized {
+    t.Fatalf("results of another party: %v", err);
+  }
+}
@@ -0,0 +1,213 @@
+package pprl;
+
+import "crypto/ed25519";
+import "crypto/rand";
+import "crypto/sha256";
+import "crypto/x509";
+import "encoding/base64";
+import "encoding/hex";
+import "encoding/json";
+import "encoding/pem";
+import "fmt";
+import "io";
+import "time";
+
+/*
+  signed statement of what an encoded file holds, handed over with it; the
+  record hash covers identifiers, line numbers and filters in order, so text
+  and binary containers of the same records share a manifest
+*/
+type EncodingManifest struct {
+  Sha256 string `json:"sha256"`;           // RecordHash of the records, hex
+  Schema string `json:"schema"`;           // SchemaHash of the metadata, hex
+  Hardening string `json:"hardening"`;     // hardening applied to the filters, "none" if unhardened
+  KeyId string `json:"key_id,omitempty"`;  // key of keyed hashing, never the key itself
+  Count int `json:"count"`;                // #record
+  Created string `json:"created"`;         // time of signing, RFC 3339 UTC
+  PublicKey string `json:"public_key"`;    // ed25519 key of the signer, base64
+  Signature string `json:"signature"`;     // ed25519 over the manifest without signature, base64
+}
+
+/* manifest field that does not hold */
+type ManifestError struct {
+  Field string;                 // json name of the field
+  Err error;                    // actual error
+}
+
+/* signed message starts with this, so that signatures are not reused elsewhere */
+const _manifest_domain = "pprl encoding manifest v1\n";
+
+func (e *ManifestError) Error() (string) {
+  return fmt.Sprintf("manifest %s: %s", (*e).Field, (*e).Err.Error());
+}
+
+/* sha256 over records laid out as in a stream chunk, see NewStreamReader */
+func RecordHash(filters []*Filter) ([sha256.Size]byte) {
+  h := sha256.New();
+  var buf []byte;
+  for _, f := range filters {
+    buf = append_record(buf[:0], f);
+    h.Write(buf);
+  }
+  var sum [sha256.Size]byte;
+  copy(sum[:], h.Sum(nil));
+  return sum;
+}
+
+/* unsigned manifest of records under meta */
+func NewEncodingManifest(meta *Meta, filters []*Filter, created time.Time) (*EncodingManifest) {
+  records := RecordHash(filters);
+  schema := SchemaHash(meta);
+  return &EncodingManifest {
+    Sha256: hex.EncodeToString(records[:]),
+    Schema: hex.EncodeToString(schema[:]),
+    Hardening: meta.AppliedHardening(),
+    KeyId: (*meta).KeyId,
+    Count: len(filters),
+    Created: created.UTC().Format(time.RFC3339),
+  };
+}
+
+/* sign with key, public key and signature are filled in */
+func (m *EncodingManifest) Sign(key ed25519.PrivateKey) (error) {
+  if len(key) != ed25519.PrivateKeySize {
+    return ErrKeyFormat;
+  }
+  (*m).PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey));
+  message, err := m.message();
+  if err != nil {
+    return err;
+  }
+  (*m).Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, message));
+  return nil;
+}
+
+/*
+  check the signature, the signer against trusted (any signer if nil), and
+  that the records and metadata are those the manifest was made for
+*/
+func (m *EncodingManifest) Verify(meta *Meta, filters []*Filter, trusted ed25519.PublicKey) (error) {
+  public, err := base64.StdEncoding.DecodeString((*m).PublicKey);
+  if err != nil || len(public) != ed25519.PublicKeySize {
+    return &ManifestError{"public_key", ErrKeyFormat};
+  }
+  if trusted != nil && !trusted.Equal(ed25519.PublicKey(public)) {
+    return &ManifestError{"public_key", ErrSigner};
+  }
+  signature, err := base64.StdEncoding.DecodeString((*m).Signature);
+  if err != nil {
+    return &ManifestError{"signature", ErrSignature};
+  }
+  message, err := m.message();
+  if err != nil {
+    return err;
+  }
+  if !ed25519.Verify(public, message, signature) {
+    return &ManifestError{"signature", ErrSignature};
+  }
+  /* the signature holds, what remains is whether these are the signed records */
+  actual := NewEncodingManifest(meta, filters, time.Time{});
+  switch {
+  case (*actual).Schema != (*m).Schema:
+    return &ManifestError{"schema", ErrManifest};
+  case (*actual).Hardening != (*m).Hardening:
+    return &ManifestError{"hardening", ErrManifest};
+  case (*actual).KeyId != (*m).KeyId:
+    return &ManifestError{"key_id", ErrManifest};
+  case (*actual).Count != (*m).Count:
+    return &ManifestError{"count", ErrManifest};
+  case (*actual).Sha256 != (*m).Sha256:
+    return &ManifestError{"sha256", ErrManifest};
+  }
+  return nil;
+}
+
+/* bytes covered by the signature */
+func (m *EncodingManifest) message() ([]byte, error) {
+  unsigned := *m;
+  unsigned.Signature = "";
+  data, err := json.Marshal(&unsigned);
+  if err != nil {
+    return nil, err;
+  }
+  return append([]byte(_manifest_domain), data...), nil;
+}
+
+/* new ed25519 signing key */
+func GenerateSigningKey() (ed25519.PrivateKey, error) {
+  _, key, err := ed25519.GenerateKey(rand.Reader);
+  return key, err;
+}
+
+/* write a signing key as PKCS #8 PEM */
+func WriteSigningKey(w io.Writer, key ed25519.PrivateKey) (error) {
+  der, err := x509.MarshalPKCS8PrivateKey(key);
+  if err != nil {
+    return err;
+  }
+  return pem.Encode(w, &pem.Block{Type: "PRIVATE KEY", Bytes: der});
+}
+
+/* write a public key as PKIX PEM */
+func WritePublicKey(w io.Writer, key ed25519.PublicKey) (error) {
+  der, err := x509.MarshalPKIXPublicKey(key);
+  if err != nil {
+    return err;
+  }
+  return pem.Encode(w, &pem.Block{Type: "PUBLIC KEY", Bytes: der});
+}
+
+/* signing key from PEM written by WriteSigningKey */
+func ParseSigningKey(data []byte) (ed25519.PrivateKey, error) {
+  block, _ := pem.Decode(data);
+  if block == nil || (*block).Type != "PRIVATE KEY" {
+    return nil, ErrKeyFormat;
+  }
+  parsed, err := x509.ParsePKCS8PrivateKey((*block).Bytes);
+  if err != nil {
+    return nil, ErrKeyFormat;
+  }
+  key, ok := parsed.(ed25519.PrivateKey);
+  if !ok {
+    return nil, ErrKeyFormat;
+  }
+  return key, nil;
+}
+
+/* public key from PEM written by WritePublicKey */
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+  block, _ := pem.Decode(data);
+  if block == nil || (*block).Type != "PUBLIC KEY" {
+    return nil, ErrKeyFormat;
+  }
+  parsed, err := x509.ParsePKIXPublicKey((*block).Bytes);
+  if err != nil {
+    return nil, ErrKeyFormat;
+  }
+  key, ok := parsed.(ed25519.PublicKey);
+  if !ok {
+    return nil, ErrKeyFormat;
+  }
+  return key, nil;
+}
+
+/* write a manifest as indented JSON */
+func WriteManifest(w io.Writer, m *EncodingManifest) (error) {
+  data, err := json.MarshalIndent(m, "", "  ");
+  if err != nil {
+    return err;
+  }
+  _, err = w.Write(append(data, '\n'));
+  return err;
+}
+
+/* read a manifest written by WriteManifest */
+func ReadManifest(r io.Reader) (*EncodingManifest, error) {
+  m := &EncodingManifest{};
+  decoder := json.NewDecoder(r);
+  decoder.DisallowUnknownFields();
+  if err := decoder.Decode(m); err != nil {
+    return nil, err;
+  }
+  return m, nil;
+}
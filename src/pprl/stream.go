@@ -0,0 +1,380 @@
+package pprl;
+
+import "bufio";
+import "crypto/sha256";
+import "encoding/hex";
+import "encoding/json";
+import "hash";
+import "hash/crc32";
+import "io";
+
+import "util/tannhauser/numbers";
+
+/*
+  streaming exchange of encoded records, for sets too large for one request;
+  all integers little endian:
+
+    stream    magic "PPRLST01", then frames
+    frame     kind (1), payload length (4), payload, crc32c of kind, length and payload (4)
+    record    bloom filter (ceil(bloom_bit / 8)), line (4), id length (4), id
+
+  a stream is one meta frame (Meta JSON with count), chunk frames of records
+  back to back, and an end frame (Manifest JSON); each chunk is checked as it
+  arrives and the manifest checks the whole, so neither side holds the set
+  in memory; the receiver answers with the end frame it computed, or an
+  error frame with a message
+*/
+const _stream_magic = "PPRLST01";
+const _max_frame = 64 << 20;    // largest frame payload accepted
+
+/* frame kinds */
+const _frame_meta = 'M';
+const _frame_chunk = 'C';
+const _frame_end = 'E';
+const _frame_error = 'X';
+
+/* default #byte of records per chunk */
+const _default_stream_chunk = 1 << 20;
+
+/* summary of a stream, sent last */
+type Manifest struct {
+  Count int `json:"count"`;     // #record
+  Chunk int `json:"chunk"`;     // #chunk frame
+  Byte int64 `json:"byte"`;     // #byte of chunk payloads
+  Sha256 string `json:"sha256"`; // sha256 over chunk payloads in order
+  Schema string `json:"schema"`; // schema hash of the metadata, hex
+}
+
+/* sender side, records are buffered up to a chunk */
+type StreamWriter struct {
+  w *bufio.Writer;
+  row int;                      // #byte per bloom filter
+  size int;                     // #byte of records per chunk
+  buf []byte;                   // records of the pending chunk
+  hash hash.Hash;               // over chunk payloads
+  manifest Manifest;
+  count int;                    // #record promised in metadata
+}
+
+/* receiver side, records are decoded one chunk at a time */
+type StreamReader struct {
+  Meta *Meta;                   // metadata of the stream
+  r *bufio.Reader;
+  row int;                      // #byte per bloom filter
+  chunk []byte;                 // remaining records of the current chunk
+  hash hash.Hash;               // over chunk payloads
+  manifest Manifest;            // computed while reading
+  done bool;                    // end frame verified
+}
+
+var _crc32c = crc32.MakeTable(crc32.Castagnoli);
+
+/* start a stream of meta.Count records, chunks hold about size bytes (0 for default) */
+func NewStreamWriter(w io.Writer, meta *Meta, size int) (*StreamWriter, error) {
+  if size <= 0 {
+    size = _default_stream_chunk;
+  }
+  if size > _max_frame {
+    size = _max_frame;
+  }
+  header, err := json.Marshal(meta);
+  if err != nil {
+    return nil, err;
+  }
+  schema := SchemaHash(meta);
+  s := &StreamWriter {
+    w: bufio.NewWriter(w),
+    row: ((*meta).Mb + 7) / 8,
+    size: size,
+    hash: sha256.New(),
+    count: (*meta).Count,
+  };
+  (*s).manifest.Schema = hex.EncodeToString(schema[:]);
+  (*s).w.WriteString(_stream_magic);
+  if err = write_frame((*s).w, _frame_meta, header); err != nil {
+    return nil, err;
+  }
+  return s, nil;
+}
+
+/* add a record, a full chunk is sent */
+func (s *StreamWriter) Write(f *Filter) (error) {
+  if len((*f).Bits) != (*s).row {
+    return ErrIndexBit;
+  }
+  if len((*s).buf) > 0 && len((*s).buf) + (*s).row + 8 + len((*f).Id) > (*s).size {
+    if err := s.flush(); err != nil {
+      return err;
+    }
+  }
+  (*s).buf = append_record((*s).buf, f);
+  (*s).manifest.Count++;
+  return nil;
+}
+
+/* send the pending chunk and the manifest, w is not closed */
+func (s *StreamWriter) Close() (*Manifest, error) {
+  if (*s).manifest.Count != (*s).count {
+    return nil, ErrFilterCount;
+  }
+  if err := s.flush(); err != nil {
+    return nil, err;
+  }
+  (*s).manifest.Sha256 = hex.EncodeToString((*s).hash.Sum(nil));
+  end, err := json.Marshal(&(*s).manifest);
+  if err != nil {
+    return nil, err;
+  }
+  if err = write_frame((*s).w, _frame_end, end); err != nil {
+    return nil, err;
+  }
+  if err = (*s).w.Flush(); err != nil {
+    return nil, err;
+  }
+  m := (*s).manifest;
+  return &m, nil;
+}
+
+/* send buffered records as a chunk */
+func (s *StreamWriter) flush() (error) {
+  if len((*s).buf) == 0 {
+    return nil;
+  }
+  (*s).hash.Write((*s).buf);
+  (*s).manifest.Chunk++;
+  (*s).manifest.Byte += int64(len((*s).buf));
+  err := write_frame((*s).w, _frame_chunk, (*s).buf);
+  (*s).buf = (*s).buf[:0];
+  return err;
+}
+
+/* read the stream head up to the metadata */
+func NewStreamReader(r io.Reader) (*StreamReader, error) {
+  s := &StreamReader {
+    r: bufio.NewReader(r),
+    hash: sha256.New(),
+  };
+  magic := make([]byte, len(_stream_magic));
+  if _, err := io.ReadFull((*s).r, magic); err != nil || string(magic) != _stream_magic {
+    return nil, ErrStreamFormat;
+  }
+  kind, payload, err := read_frame((*s).r);
+  if err != nil {
+    return nil, err;
+  }
+  if kind != _frame_meta {
+    return nil, ErrStreamFormat;
+  }
+  (*s).Meta = &Meta{};
+  if err = json.Unmarshal(payload, (*s).Meta); err != nil || (*(*s).Meta).Mb <= 0 || (*(*s).Meta).Count < 0 {
+    return nil, ErrStreamFormat;
+  }
+  (*s).row = ((*(*s).Meta).Mb + 7) / 8;
+  schema := SchemaHash((*s).Meta);
+  (*s).manifest.Schema = hex.EncodeToString(schema[:]);
+  return s, nil;
+}
+
+/* next record, io.EOF once the manifest is verified; the filter does not share memory with the stream */
+func (s *StreamReader) Next() (*Filter, error) {
+  for len((*s).chunk) == 0 {
+    if (*s).done {
+      return nil, io.EOF;
+    }
+    kind, payload, err := read_frame((*s).r);
+    if err != nil {
+      return nil, err;
+    }
+    switch kind {
+    case _frame_chunk:
+      (*s).hash.Write(payload);
+      (*s).manifest.Chunk++;
+      (*s).manifest.Byte += int64(len(payload));
+      (*s).chunk = payload;
+    case _frame_end:
+      if err = s.verify(payload); err != nil {
+        return nil, err;
+      }
+      (*s).done = true;
+    default:
+      return nil, ErrStreamFormat;
+    }
+  }
+  chunk := (*s).chunk;
+  if len(chunk) < (*s).row + 8 {
+    return nil, ErrStreamFormat;
+  }
+  line := numbers.B2Uint32L(chunk[(*s).row:]);
+  n := int(numbers.B2Uint32L(chunk[(*s).row + 4:]));
+  end := (*s).row + 8 + n;
+  if n < 0 || end > len(chunk) {
+    return nil, ErrStreamFormat;
+  }
+  f := &Filter {
+    Id: string(chunk[(*s).row + 8:end]),
+    Line: int(line),
+    Bits: append([]byte(nil), chunk[:(*s).row]...),
+  };
+  (*s).chunk = chunk[end:];
+  (*s).manifest.Count++;
+  if (*s).manifest.Count > (*(*s).Meta).Count {
+    return nil, ErrStreamManifest;
+  }
+  return f, nil;
+}
+
+/* manifest computed by the reader, complete after Next returned io.EOF */
+func (s *StreamReader) Manifest() (*Manifest) {
+  m := (*s).manifest;
+  return &m;
+}
+
+/* compare the sent manifest with what was read */
+func (s *StreamReader) verify(payload []byte) (error) {
+  var sent Manifest;
+  if err := json.Unmarshal(payload, &sent); err != nil {
+    return ErrStreamFormat;
+  }
+  (*s).manifest.Sha256 = hex.EncodeToString((*s).hash.Sum(nil));
+  if sent != (*s).manifest || sent.Count != (*(*s).Meta).Count {
+    return ErrStreamManifest;
+  }
+  return nil;
+}
+
+/* stream the records of src under meta, whose count must match them */
+func SendStream(w io.Writer, meta *Meta, src FilterSource, size int) (*Manifest, error) {
+  s, err := NewStreamWriter(w, meta, size);
+  if err != nil {
+    return nil, err;
+  }
+  for {
+    f, err := src.Next();
+    if err == io.EOF {
+      break;
+    }
+    if err != nil {
+      return nil, err;
+    }
+    if err = s.Write(f); err != nil {
+      return nil, err;
+    }
+  }
+  return s.Close();
+}
+
+/* read a stream and write it to w as encoded output, record by record */
+func ReceiveStream(r io.Reader, w io.Writer) (*Meta, *Manifest, error) {
+  s, err := NewStreamReader(r);
+  if err != nil {
+    return nil, nil, err;
+  }
+  bw := bufio.NewWriter(w);
+  if err = write_meta(bw, (*s).Meta); err != nil {
+    return nil, nil, err;
+  }
+  for {
+    f, err := s.Next();
+    if err == io.EOF {
+      break;
+    }
+    if err != nil {
+      return nil, nil, err;
+    }
+    if err = write_filter(bw, f); err != nil {
+      return nil, nil, err;
+    }
+  }
+  if err = bw.Flush(); err != nil {
+    return nil, nil, err;
+  }
+  return (*s).Meta, s.Manifest(), nil;
+}
+
+/* answer a sender with the manifest received, or with the error that stopped it */
+func WriteStreamAck(w io.Writer, m *Manifest, failure error) (error) {
+  bw := bufio.NewWriter(w);
+  var err error;
+  if failure != nil {
+    err = write_frame(bw, _frame_error, []byte(failure.Error()));
+  } else {
+    var end []byte;
+    if end, err = json.Marshal(m); err == nil {
+      err = write_frame(bw, _frame_end, end);
+    }
+  }
+  if err != nil {
+    return err;
+  }
+  return bw.Flush();
+}
+
+/* read the answer of a receiver and check it against the manifest sent, if not nil */
+func ReadStreamAck(r io.Reader, sent *Manifest) (error) {
+  kind, payload, err := read_frame(bufio.NewReader(r));
+  if err != nil {
+    return err;
+  }
+  switch kind {
+  case _frame_error:
+    return Error("receiver failed: " + string(payload));
+  case _frame_end:
+    var got Manifest;
+    if err = json.Unmarshal(payload, &got); err != nil {
+      return ErrStreamFormat;
+    }
+    if sent != nil && got != *sent {
+      return ErrStreamManifest;
+    }
+    return nil;
+  }
+  return ErrStreamFormat;
+}
+
+/* append a record in chunk layout */
+func append_record(buf []byte, f *Filter) ([]byte) {
+  var n [8]byte;
+  numbers.PutUi32L(n[:4], uint32((*f).Line));
+  numbers.PutUi32L(n[4:], uint32(len((*f).Id)));
+  buf = append(buf, (*f).Bits...);
+  buf = append(buf, n[:]...);
+  return append(buf, (*f).Id...);
+}
+
+/* write a frame with its checksum */
+func write_frame(w *bufio.Writer, kind byte, payload []byte) (error) {
+  var head [5]byte;
+  head[0] = kind;
+  numbers.PutUi32L(head[1:], uint32(len(payload)));
+  sum := crc32.Update(crc32.Checksum(head[:], _crc32c), _crc32c, payload);
+  var tail [4]byte;
+  numbers.PutUi32L(tail[:], sum);
+  w.Write(head[:]);
+  w.Write(payload);
+  _, err := w.Write(tail[:]);
+  return err;
+}
+
+/* read a frame and check its checksum */
+func read_frame(r *bufio.Reader) (byte, []byte, error) {
+  var head [5]byte;
+  if _, err := io.ReadFull(r, head[:]); err != nil {
+    if err == io.EOF {
+      err = io.ErrUnexpectedEOF;
+    }
+    return 0, nil, err;
+  }
+  n := numbers.B2Uint32L(head[1:]);
+  if n > _max_frame {
+    return 0, nil, ErrStreamFormat;
+  }
+  payload := make([]byte, n + 4);
+  if _, err := io.ReadFull(r, payload); err != nil {
+    return 0, nil, io.ErrUnexpectedEOF;
+  }
+  sum := crc32.Update(crc32.Checksum(head[:], _crc32c), _crc32c, payload[:n]);
+  if numbers.B2Uint32L(payload[n:]) != sum {
+    return 0, nil, ErrStreamChecksum;
+  }
+  return head[0], payload[:n], nil;
+}
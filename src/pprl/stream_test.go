@@ -0,0 +1,155 @@
+package pprl;
+
+import "bufio";
+import "bytes";
+import "encoding/json";
+import "errors";
+import "io";
+import "math/rand";
+import "net";
+import "strconv";
+import "testing";
+
+/* FilterSource over a slice */
+type slice_source struct {
+  filters []*Filter;
+}
+
+func (s *slice_source) Next() (*Filter, error) {
+  if len((*s).filters) == 0 {
+    return nil, io.EOF;
+  }
+  f := (*s).filters[0];
+  (*s).filters = (*s).filters[1:];
+  return f, nil;
+}
+
+/* records spread over several chunks */
+func test_stream_filters(count int) (*Meta, []*Filter) {
+  meta := &Meta{Mb: 100, Ngram: 2, K: []int{4}, Field: []string{"name"}, Count: count};
+  r := rand.New(rand.NewSource(1));
+  filters := make([]*Filter, count);
+  for i := range filters {
+    bits := make([]byte, 13);
+    r.Read(bits);
+    filters[i] = &Filter{"id" + strconv.Itoa(i), i + 2, bits};
+  }
+  return meta, filters;
+}
+
+/* a whole stream as bytes */
+func test_stream(t *testing.T) ([]byte) {
+  meta, filters := test_stream_filters(100);
+  var buf bytes.Buffer;
+  if _, err := SendStream(&buf, meta, &slice_source{filters}, 256); err != nil {
+    t.Fatal(err);
+  }
+  return buf.Bytes();
+}
+
+/* frames of a stream, each with its kind and payload */
+func split_frames(t *testing.T, data []byte) ([]byte, [][]byte) {
+  r := bufio.NewReader(bytes.NewReader(data[len(_stream_magic):]));
+  var kinds []byte;
+  var payloads [][]byte;
+  for {
+    kind, payload, err := read_frame(r);
+    if err != nil {
+      break;
+    }
+    kinds = append(kinds, kind);
+    payloads = append(payloads, payload);
+  }
+  if len(kinds) < 3 || kinds[len(kinds) - 1] != _frame_end {
+    t.Fatalf("stream has %d frames", len(kinds));
+  }
+  return kinds, payloads;
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+  meta, filters := test_stream_filters(100);
+  sender, receiver := net.Pipe();
+  defer receiver.Close();
+  sent := make(chan error, 1);
+  go func() {
+    defer sender.Close();
+    manifest, err := SendStream(sender, meta, &slice_source{filters}, 256);
+    if err == nil {
+      err = ReadStreamAck(sender, manifest);
+    }
+    sent <- err;
+  } ();
+  var out bytes.Buffer;
+  _, manifest, err := ReceiveStream(receiver, &out);
+  if err != nil {
+    t.Fatal(err);
+  }
+  if err = WriteStreamAck(receiver, manifest, nil); err != nil {
+    t.Fatal(err);
+  }
+  if err = <-sent; err != nil {
+    t.Fatal(err);
+  }
+  if (*manifest).Count != 100 || (*manifest).Chunk < 2 {
+    t.Fatalf("manifest %+v, expected 100 records in several chunks", *manifest);
+  }
+  _, got, err := ReadFilters(&out);
+  if err != nil {
+    t.Fatal(err);
+  }
+  for i, f := range got {
+    if (*f).Id != (*filters[i]).Id || (*f).Line != (*filters[i]).Line || !bytes.Equal((*f).Bits, (*filters[i]).Bits) {
+      t.Fatalf("record %d differs after the round trip", i);
+    }
+  }
+}
+
+func TestStreamFlippedByte(t *testing.T) {
+  data := test_stream(t);
+  /* a byte inside the first chunk, after the meta frame */
+  kinds, payloads := split_frames(t, data);
+  if kinds[1] != _frame_chunk {
+    t.Fatalf("second frame is %c", kinds[1]);
+  }
+  at := len(_stream_magic) + 5 + len(payloads[0]) + 4 + 5 + 10;
+  data[at] ^= 1;
+  if _, _, err := ReceiveStream(bytes.NewReader(data), io.Discard); !errors.Is(err, ErrStreamChecksum) {
+    t.Fatalf("flipped byte: %v", err);
+  }
+}
+
+func TestStreamTruncated(t *testing.T) {
+  data := test_stream(t);
+  for _, n := range []int{len(data) - 1, len(data) / 2, len(_stream_magic) + 3} {
+    if _, _, err := ReceiveStream(bytes.NewReader(data[:n]), io.Discard); !errors.Is(err, io.ErrUnexpectedEOF) {
+      t.Fatalf("stream cut at %d of %d: %v", n, len(data), err);
+    }
+  }
+}
+
+func TestStreamWrongManifest(t *testing.T) {
+  data := test_stream(t);
+  kinds, payloads := split_frames(t, data);
+  var m Manifest;
+  if err := json.Unmarshal(payloads[len(payloads) - 1], &m); err != nil {
+    t.Fatal(err);
+  }
+  /* a valid frame, but a hash that is not over the chunks sent */
+  digit := "0";
+  if m.Sha256[:1] == digit {
+    digit = "1";
+  }
+  m.Sha256 = digit + m.Sha256[1:];
+  end, _ := json.Marshal(&m);
+  payloads[len(payloads) - 1] = end;
+  var buf bytes.Buffer;
+  w := bufio.NewWriter(&buf);
+  w.WriteString(_stream_magic);
+  for i, kind := range kinds {
+    write_frame(w, kind, payloads[i]);
+  }
+  w.Flush();
+  if _, _, err := ReceiveStream(&buf, io.Discard); !errors.Is(err, ErrStreamManifest) {
+    t.Fatalf("wrong manifest hash: %v", err);
+  }
+}
@@ -1,46 +1,99 @@
 package pprl;
 
+import "context";
 import "fmt";
 import "math";
 import "log";
-import "sync";
+import "os";
+import "sort";
 
 /* prepare dataset and meta data */
 func(cf *Config) PrepareDataset() (error) {
+  return cf.PrepareDatasetContext(context.Background());
+}
+
+/* prepare dataset and meta data, stop at the next batch once ctx is done */
+func(cf *Config) PrepareDatasetContext(ctx context.Context) (error) {
   var err error;
+  if _, err = cf.MakePlan(ctx); err != nil {
+    return err;
+  }
+  log.Printf("[PrepareDataset] Setting bloom filters...\n");
+  if err = (*cf).set_bloom_filter(ctx); err != nil {
+    return err;
+  }
+  return nil;
+}
+
+/* encode datasets with the parameters of previously encoded records instead of planning anew */
+func (cf *Config) PrepareDatasetMeta(ctx context.Context, meta *Meta) (error) {
+  if (*meta).Mb != (*cf).Mb || (*meta).Ngram != (*(*cf).Ng) || len((*meta).K) != (*(*cf).Nf) {
+    return ErrSchema;
+  }
+  if (*meta).KeyId != (*cf).key.id() {
+    return ErrKeyMismatch;
+  }
+  if (*meta).Seed != meta_seed((*cf).HashSeed) {
+    return ErrSeedMismatch;
+  }
+  for i, k := range (*meta).K {
+    /* ignored fields are the ones without hash */
+    if (k == 0) != (*cf).ignore[i] {
+      return &PlanError{i, cf.field_name(i), ErrSchema};
+    }
+  }
+  if err := cf.Analyze(ctx); err != nil {
+    return err;
+  }
+  copy((*cf).k, (*meta).K);
+  log.Printf("[PrepareDataset] Setting bloom filters...\n");
+  return cf.set_bloom_filter(ctx);
+}
+
+/* field statistics and n-grams of all datasets, done once per config */
+func (cf *Config) Analyze(ctx context.Context) (error) {
+  if (*cf).analyzed {
+    return nil;
+  }
+  cf.average_ngram();
   log.Printf("[PrepareDataset] Loading datasets...\n");
   for i, d := range (*cf).dataset {
     if (*cf).debug {
       log.Printf("[PrepareDataset] preparing dataset %d\n", i);
     }
-    err = d.prepare_dataset();
-    if err != nil {
+    if err := d.prepare_dataset(ctx); err != nil {
       return err;
     }
     if (*cf).debug {
       log.Printf("[PrepareDataset] dataset %d prepared\n", i);
     }
   }
+  (*cf).analyzed = true;
+  return nil;
+}
+
+/* analyze datasets, then weight fields and plan encoding parameters */
+func (cf *Config) MakePlan(ctx context.Context) (*Plan, error) {
+  if err := cf.Analyze(ctx); err != nil {
+    return nil, err;
+  }
   log.Printf("[PrepareDataset] Calculating weights...\n");
-  if err = cf.weight_entropy(); err != nil {
-    return err;
+  if err := cf.weight_entropy(); err != nil {
+    return nil, err;
   }
   log.Printf("[PrepareDataset] Preparing encoding...\n");
   if err := cf.prepare_encoding(); err != nil {
-    return err;
-  }
-  log.Printf("[PrepareDataset] Setting bloom filters...\n");
-  if err = (*cf).set_bloom_filter(); err != nil {
-    return err;
+    return nil, err;
   }
-  return nil;
+  return (*cf).plan, nil;
 }
 
 /* prepare a single dataset */
-func (d *Dataset) prepare_dataset() (error) {
-  d.entropy();
-  d.ngram();
-  return nil;
+func (d *Dataset) prepare_dataset(ctx context.Context) (error) {
+  if err := d.entropy(ctx); err != nil {
+    return err;
+  }
+  return d.ngram(ctx);
 }
 
 /* display field metadata */
@@ -48,8 +101,8 @@ func (cf *Config) PrintMeta() {
   for i := 0; i < (*(*cf).Nf); i++ {
     fmt.Printf("Weight of field %d: %f\n", i, (*cf).weight[i]);
   }
-  for i := 0; i < (*(*cf).Nf); i++ {
-    fmt.Printf("k, m, g of field %d: %d, %d, %f\n", i, (*cf).k[i], (*cf).m[i], (*cf).g[i]);
+  if (*cf).plan != nil {
+    (*cf).plan.Print(os.Stdout);
   }
   for i := 0; i < (*cf).nd; i++ {
     fmt.Printf("Printing metadata for dataset %d...\n", i);
@@ -63,23 +116,26 @@ func (d *Dataset) print_meta() {
     if (*(*d).ignore)[i] {
       fmt.Printf("[%s] field ignored.\n", (*(*d).field[i]).name);
     } else {
-      fmt.Printf("[%s] entropy: %f, avg_n_gram: %d\n", (*(*d).field[i]).name, (*(*d).field[i]).entropy, (*d).g[i]);
+      fmt.Printf("[%s] entropy: %f, avg_n_gram: %f\n", (*(*d).field[i]).name, (*(*d).field[i]).entropy, (*d).g[i]);
     }
   }
 }
 
 /* calculate entropy */
-func (d *Dataset) entropy() {
+func (d *Dataset) entropy(ctx context.Context) (error) {
   var field *FieldMeta;
-  var wg sync.WaitGroup;
   var ent, prob, total float64;
 
   /* first pass, array version */
-  for i := 0; i < (*(*d).nf); i++ {
-    wg.Add(1);
-    go go_first_pass(d, i, &wg);
+  progress := new_progress((*(*d).progress), StageEntropy, (*d).index, int64((*(*d).nf) * (*d).nr));
+  err := (*d).workers.RunChunkContext(ctx, (*(*d).nf), 1, func(start, end int) {
+    for i := start; i < end; i++ {
+      go_first_pass(d, i, progress);
+    }
+  });
+  if err != nil {
+    return err;
   }
-  wg.Wait();
 
   /* second pass, entropy calculation */
   for i := 0; i < (*(*d).nf); i++ {
@@ -87,7 +143,14 @@ func (d *Dataset) entropy() {
       field = (*d).field[i];
       total = (*field).total;
       (*field).entropy = 0;
-      for _, v := range (*field).freq {
+      /* sum in key order, so that weights are identical between runs */
+      keys := make([]string, 0, len((*field).freq));
+      for k := range (*field).freq {
+        keys = append(keys, k);
+      }
+      sort.Strings(keys);
+      for _, k := range keys {
+        v := (*field).freq[k];
         if v != 0 {
           prob = v / total;
           ent = math.Log2(prob);
@@ -101,28 +164,24 @@ func (d *Dataset) entropy() {
       }
     }
   }
+  return nil;
 }
 
 /* dispatch parse items to corresponding location */
-func go_first_pass(ds *Dataset, this int, w *sync.WaitGroup) {
+func go_first_pass(ds *Dataset, this int, progress *progress_tracker) {
   var cnt float64;
   var ok bool;
   /* if this field is ignored */
   if (*(*ds).ignore)[this] {
-    (*w).Done();
+    progress.add(int64((*ds).nr));
     return;
   }
-  /* get a go routine */
-  go_routine := get_go();
-  defer func() {
-    go_routine.free_go();
-    (*w).Done();
-  } ();
-  //one_percent := (*ds).nr / 100;
   field := (*ds).field[this];
   (*field).exists = 0;
   (*field).total = 0;
   var raw string;
+  /* counted locally, the tracker lock is taken once per batch */
+  var done int64;
   for j := 0; j < (*ds).nr; j++ {
     if (*ds).record[j] == nil {
       log.Printf("[PPRL][go_first_pass] record %d is nil\n", j);
@@ -141,48 +200,72 @@ func go_first_pass(ds *Dataset, this int, w *sync.WaitGroup) {
       (*field).exists++;
     }
     (*field).total++;
-    /*
-    if int((*field).total) % one_percent == 0 {
-      percent := float64((*field).total)/float64((*ds).nr)*float64(100);
-      log.Printf("%.2f%% of field [%s] in first pass...\n", percent, (*(*ds).field[this]).name);
+    done++;
+    if done == _progress_batch {
+      progress.add(done);
+      done = 0;
     }
-    //*/
   }
+  progress.add(done);
 }
 
 /* controller n-gram calculation */
-func (d *Dataset) ngram() {
-  var wg sync.WaitGroup;
-  for i := 0; i < (*d).nr; i++ {
-    for j := 0; j < (*(*d).nf); j++ {
-      if !(*(*d).ignore)[j] {
-        wg.Add(1);
-        go (*(*d).record[i]).field[j].make_ngram(&wg);
+func (d *Dataset) ngram(ctx context.Context) (error) {
+  progress := new_progress((*(*d).progress), StageNgram, (*d).index, int64((*d).nr));
+  return (*d).workers.RunContext(ctx, (*d).nr, func(start, end int) {
+    for i := start; i < end; i++ {
+      for j := 0; j < (*(*d).nf); j++ {
+        if !(*(*d).ignore)[j] {
+          (*(*d).record[i]).field[j].make_ngram();
+        }
       }
     }
-  }
-  wg.Wait();
+    progress.add(int64(end - start));
+  });
 }
 
 /* n-gram calculation */
-func (f *Field) make_ngram(wg *sync.WaitGroup) {
-  /* get a go routine */
-  go_routine := get_go();
-  defer func() {
-    go_routine.free_go();
-    (*wg).Done();
-  } ();
-  padding_len := (*(*f).ng) - 1;
-  ngram_len := len((*f).raw) - padding_len;
+func (f *Field) make_ngram() {
+  /* same count as FieldMeta.sum_n_gram, missing value gives a single blank n-gram */
+  ngram_len := len((*f).padded) - (*(*f).ng) + 1;
+  if ngram_len < 0 {
+    ngram_len = 0;
+  }
   (*f).ngram = make([]string, ngram_len);
   for i := 0; i < ngram_len; i++ {
-    (*f).ngram[i] = (*f).padded[i:i + padding_len];
+    (*f).ngram[i] = (*f).padded[i:i + (*(*f).ng)];
   }
 }
 
-/* encode to bloom filter */
+/* encode to bloom filter, set bits from bloom table indexes of all fields */
 func (d *Dataset) Encoding() (error) {
-  return nil;
+  return d.encoding(context.Background());
+}
+
+/* encode to bloom filter until ctx is done */
+func (d *Dataset) encoding(ctx context.Context) (error) {
+  progress := new_progress((*(*d).progress), StageEncode, (*d).index, int64((*d).nr));
+  bloom_table := (*(*d).enc).bloom_table;
+  return (*d).workers.RunContext(ctx, (*d).nr, func(start, end int) {
+    var slot int;
+    for _, r := range (*d).record[start:end] {
+      if r == nil {
+        continue;
+      }
+      for i, f := range (*r).field {
+        if (*(*d).ignore)[i] {
+          continue;
+        }
+        for _, index := range (*f).bf_index {
+          for _, bit := range index {
+            slot = bit / 8;
+            (*r).bloom_filter[slot] |= bloom_table[bit][slot];
+          }
+        }
+      }
+    }
+    progress.add(int64(end - start));
+  });
 }
 
 
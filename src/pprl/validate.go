@@ -0,0 +1,284 @@
+package pprl;
+
+import "bufio";
+import "fmt";
+import "log";
+import "os";
+import "strconv";
+import "strings";
+
+/* problem of a config field */
+type ConfigProblem struct {
+  Field string;                 // json name of the field
+  Message string;               // what is wrong, with the offending value
+  Warning bool;                 // config works, but likely not as intended
+  Err error;                    // kind of problem, e.g. ErrInvalidIgnore
+}
+
+/* all errors found in a config, reported at once */
+type ConfigError struct {
+  Problem []*ConfigProblem;
+}
+
+/* bits of a block key, see block_key */
+const _max_block = 64;
+
+func (p *ConfigProblem) String() (string) {
+  if (*p).Warning {
+    return fmt.Sprintf("%s: warning: %s", (*p).Field, (*p).Message);
+  }
+  return fmt.Sprintf("%s: %s", (*p).Field, (*p).Message);
+}
+
+func (e *ConfigError) Error() (string) {
+  msg := make([]string, len((*e).Problem));
+  for i, p := range (*e).Problem {
+    msg[i] = p.String();
+  }
+  return fmt.Sprintf("%d problems in config: %s", len(msg), strings.Join(msg, "; "));
+}
+
+/* kinds of the problems, for errors.Is */
+func (e *ConfigError) Unwrap() ([]error) {
+  errs := make([]error, len((*e).Problem));
+  for i, p := range (*e).Problem {
+    errs[i] = (*p).Err;
+  }
+  return errs;
+}
+
+/*
+  check every field of a config file and return all problems; with data,
+  datasets are opened as well to compare line counts with size and head
+  lines with num_field; overrides apply as when loading, see LoadConfig;
+  the error is only for a file that cannot be parsed
+*/
+func ValidateConfig(path string, set []string, data bool) ([]*ConfigProblem, error) {
+  cf := &Config{conf: path, set: set};
+  if err := cf.read_config(); err != nil {
+    return nil, err;
+  }
+  problems := cf.validate();
+  if data && !has_error(problems) {
+    problems = append(problems, cf.validate_data()...);
+  }
+  return problems, nil;
+}
+
+/* static checks on fields as read, before defaults are filled in */
+func (cf *Config) validate() ([]*ConfigProblem) {
+  p := cf.validate_dataset();
+  return append(p, cf.validate_fields()...);
+}
+
+/* dataset, size and their agreement */
+func (cf *Config) validate_dataset() ([]*ConfigProblem) {
+  var p []*ConfigProblem;
+  fail := func(field string, err error, format string, arg ...interface{}) {
+    p = append(p, &ConfigProblem{field, fmt.Sprintf(format, arg...), false, err});
+  };
+  if strings.TrimSpace((*cf).Dataset) == "" {
+    fail("dataset", ErrConfigSizeNotMatch, "missing, should list dataset files separated by \",\"");
+  } else {
+    path := strings.Split((*cf).Dataset, ",");
+    /* size is optional, but if given there is one per dataset */
+    if strings.TrimSpace((*cf).Size) != "" {
+      size := strings.Split((*cf).Size, ",");
+      if len(size) != len(path) {
+        fail("size", ErrConfigSizeNotMatch, "%d sizes for %d datasets", len(size), len(path));
+      }
+      for i, s := range size {
+        if n, err := strconv.Atoi(strings.TrimSpace(s)); strings.TrimSpace(s) != "" && (err != nil || n < 0) {
+          fail("size", ErrSize, "entry %d (%q) should be a non-negative integer or empty", i, s);
+        }
+      }
+    }
+    for i, name := range path {
+      if strings.TrimSpace(name) == "" {
+        fail("dataset", ErrConfigSizeNotMatch, "dataset %d has an empty path", i);
+      }
+    }
+  }
+  return p;
+}
+
+/* fields other than datasets, as used by NewConfig as well */
+func (cf *Config) validate_fields() ([]*ConfigProblem) {
+  var p []*ConfigProblem;
+  fail := func(field string, err error, format string, arg ...interface{}) {
+    p = append(p, &ConfigProblem{field, fmt.Sprintf(format, arg...), false, err});
+  };
+  warn := func(field string, err error, format string, arg ...interface{}) {
+    p = append(p, &ConfigProblem{field, fmt.Sprintf(format, arg...), true, err});
+  };
+  nf := 0;
+  if (*cf).Nf == nil || (*(*cf).Nf) <= 0 {
+    fail("num_field", ErrNf, "missing or not positive, should be the #column of the datasets");
+  } else {
+    nf = (*(*cf).Nf);
+  }
+  if (*cf).Ng != nil && (*(*cf).Ng) < 0 {
+    fail("ngram", ErrInvalidNgram, "%d should be positive, 0 for default %d", (*(*cf).Ng), _default_ngram);
+  }
+  mb := (*cf).Mb;
+  if mb == 0 {
+    mb = _default_mb;
+  }
+  if mb < 0 {
+    fail("bloom_bit", ErrMb, "%d should be positive", mb);
+  } else if mb % 8 != 0 {
+    warn("bloom_bit", ErrMb, "%d is not a multiple of 8, the last byte of each filter is partly unused", mb);
+  }
+  if (*cf).Blk < 0 || (*cf).Blk > _max_block {
+    fail("block_bit", ErrBlock, "%d should be within [1, %d], 0 for default %d", (*cf).Blk, _max_block, _default_block);
+  } else if (*cf).Blk > mb {
+    warn("block_bit", ErrBlock, "%d is larger than bloom_bit %d and is capped to it", (*cf).Blk, mb);
+  }
+  if (*cf).BlockIter < 0 {
+    fail("block_iter", ErrBlock, "%d should be positive, 0 for default %d", (*cf).BlockIter, _default_block_iter);
+  }
+  if (*cf).Ratio != nil && ((*(*cf).Ratio) < 0 || (*(*cf).Ratio) >= 1) {
+    fail("ratio", ErrRatio, "%g should be within (0, 1), 0 for default %g", (*(*cf).Ratio), _default_ratio);
+  }
+  min_k, max_k := (*cf).MinK, (*cf).MaxK;
+  if min_k == 0 {
+    min_k = _default_min_hash;
+  }
+  if max_k == 0 {
+    max_k = _default_max_hash;
+  }
+  if min_k < 1 {
+    fail("min_hash", ErrHashRange, "%d should be at least 1", min_k);
+  }
+  if max_k < min_k {
+    fail("max_hash", ErrHashRange, "%d is less than min_hash %d", max_k, min_k);
+  }
+  if (*cf).Threshold != nil && ((*(*cf).Threshold) < 0 || (*(*cf).Threshold) > 1) {
+    fail("threshold", ErrThreshold, "%g should be within [0, 1]", (*(*cf).Threshold));
+  }
+  if err := check_assign((*cf).Assign); err != nil {
+    fail("assign", err, "%q should be none, greedy or optimal", (*cf).Assign);
+  }
+  if err := check_seed((*cf).HashSeed); err != nil {
+    fail("hash_seed", err, "%q should be %s or %s (as in older versions), empty for default %s", (*cf).HashSeed, SeedPrefix, SeedPadding, _default_hash_seed);
+  }
+  if (*cf).AssignLimit < 0 {
+    fail("assign_limit", ErrAssign, "%d should be positive, 0 for default %d", (*cf).AssignLimit, _default_assign_limit);
+  }
+  negative := func(field string, value int) {
+    if value < 0 {
+      fail(field, ErrNegative, "%d should not be negative, 0 for default", value);
+    }
+  };
+  negative("buffer", (*cf).Buffer);
+  negative("hash", (*cf).Hash);
+  negative("max_routine", (*cf).MaxGo);
+  negative("chunk", (*cf).Chunk);
+  if (*cf).IdField != nil && nf > 0 && ((*(*cf).IdField) < 0 || (*(*cf).IdField) >= nf) {
+    fail("id_field", ErrIdField, "%d should be within [0, %d)", (*(*cf).IdField), nf);
+  }
+  if strings.TrimSpace((*cf).Ignore) != "" && nf > 0 {
+    seen := make(map[int]bool);
+    for _, s := range strings.Split((*cf).Ignore, ",") {
+      i, err := strconv.Atoi(strings.TrimSpace(s));
+      switch {
+      case err != nil:
+        fail("ignore", ErrInvalidIgnore, "%q is not a field index", s);
+      case i < 0 || i >= nf:
+        fail("ignore", ErrInvalidIgnore, "%d should be within [0, %d)", i, nf);
+      case seen[i]:
+        warn("ignore", ErrInvalidIgnore, "%d is listed twice", i);
+      default:
+        seen[i] = true;
+      }
+    }
+    if len(seen) >= nf {
+      fail("ignore", ErrNoField, "all %d fields are ignored, none left for encoding", nf);
+    }
+  }
+  if (*cf).KeyFile != "" {
+    if keys, err := ReadKeyFile((*cf).KeyFile); err != nil {
+      fail("key_file", err, "%s: %s", (*cf).KeyFile, err.Error());
+    } else if _, err = keys.Get((*cf).KeyId); err != nil {
+      fail("key_id", err, "%q is not in %s", (*cf).KeyId, (*cf).KeyFile);
+    }
+  } else if (*cf).KeyId != "" {
+    fail("key_id", ErrKeyId, "%q is set without key_file", (*cf).KeyId);
+  }
+  return p;
+}
+
+/* open each dataset, compare its line count with size and its head line with num_field */
+func (cf *Config) validate_data() ([]*ConfigProblem) {
+  var p []*ConfigProblem;
+  path := strings.Split((*cf).Dataset, ",");
+  size := strings.Split((*cf).Size, ",");
+  for i, name := range path {
+    full := (*cf).Prefix + "/" + name;
+    fp, err := os.Open(full);
+    if err != nil {
+      p = append(p, &ConfigProblem{"dataset", fmt.Sprintf("dataset %d: %s", i, err.Error()), false, err});
+      continue;
+    }
+    lines, head, err := count_lines(fp);
+    fp.Close();
+    if err != nil {
+      p = append(p, &ConfigProblem{"dataset", fmt.Sprintf("dataset %d (%s): %s", i, full, err.Error()), false, err});
+      continue;
+    }
+    if lines == 0 {
+      p = append(p, &ConfigProblem{"dataset", fmt.Sprintf("dataset %d (%s) is empty, a head line is expected", i, full), true, ErrRecordField});
+      continue;
+    }
+    if head != (*(*cf).Nf) {
+      p = append(p, &ConfigProblem{"num_field", fmt.Sprintf("%d, but the head line of dataset %d (%s) has %d fields", (*(*cf).Nf), i, full, head), head < (*(*cf).Nf), ErrRecordField});
+    }
+    /* size only reserves room, a mismatch costs reallocation or memory */
+    if i >= len(size) || strings.TrimSpace(size[i]) == "" {
+      continue;
+    }
+    if n, _ := strconv.Atoi(strings.TrimSpace(size[i])); n != lines - 1 {
+      p = append(p, &ConfigProblem{"size", fmt.Sprintf("%d for dataset %d, but %s has %d records; size is only a capacity hint", n, i, full, lines - 1), true, ErrSize});
+    }
+  }
+  return p;
+}
+
+/* #line as split when loading, and #field of the head line */
+func count_lines(fp *os.File) (int, int, error) {
+  scanner := bufio.NewScanner(fp);
+  lines, head := 0, 0;
+  for scanner.Scan() {
+    if lines == 0 {
+      head = strings.Count(scanner.Text(), ",") + 1;
+    }
+    lines++;
+  }
+  return lines, head, scanner.Err();
+}
+
+/* log warnings, errors come back together as a ConfigError */
+func check_problems(problems []*ConfigProblem) (error) {
+  var errs []*ConfigProblem;
+  for _, p := range problems {
+    if (*p).Warning {
+      log.Printf("[PPRL][validate] %s\n", p.String());
+    } else {
+      errs = append(errs, p);
+    }
+  }
+  if len(errs) > 0 {
+    return &ConfigError{errs};
+  }
+  return nil;
+}
+
+/* whether problems hold an error, not only warnings */
+func has_error(problems []*ConfigProblem) (bool) {
+  for _, p := range problems {
+    if !(*p).Warning {
+      return true;
+    }
+  }
+  return false;
+}
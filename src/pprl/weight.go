@@ -9,13 +9,16 @@ func (cf *Config) weight_entropy() (error) {
     d = (*cf).dataset[i];
     for j := 0; j < (*(*cf).Nf); j++ {
       /* calculate weight weighting, currently use (nr * entropy)/sum(nr * entropy) for all datasets */
-      if !(*cf).ignore[i] {
+      if !(*cf).ignore[j] {
         this = float64((*d).nr) * (*(*d).field[j]).entropy;
         sum += this;
         sum_entropy[j] += this;
       }
     }
   }
+  if sum == 0 {
+    return ErrZeroWeight;
+  }
   for i := 0; i < (*(*cf).Nf); i++ {
     (*cf).weight[i] = sum_entropy[i] / sum;
   }
@@ -0,0 +1,601 @@
+package config;
+
+import "bytes";
+import "encoding/json";
+import "fmt";
+import "os";
+import "path/filepath";
+import "reflect";
+import "sort";
+import "strconv";
+import "strings";
+
+const ErrSyntax = Error("Got syntax error in conf file");
+const ErrInclude = Error("Got include cycle in conf file");
+const ErrEnv = Error("Got undefined environment variable in conf file");
+
+/* key listing conf files merged under the one holding it, paths relative to it */
+const IncludeKey = "include";
+
+/* conf file formats, chosen by file extension */
+const FormatJSON = "json";
+const FormatYAML = "yaml";
+const FormatTOML = "toml";
+
+/* scalar kinds */
+const _scalar_plain = 0;          // untyped, e.g. unquoted in YAML
+const _scalar_string = 1;
+const _scalar_number = 2;
+const _scalar_bool = 3;
+const _scalar_null = 4;
+
+/* deepest include chain */
+const _max_include = 16;
+
+/*
+  scalar of a conf file, kept as text until decoded, so that a value
+  is checked against the type of the field it lands in
+*/
+type scalar struct {
+  text string;
+  kind int;
+}
+
+/* error at a key or line of a conf file */
+type KeyError struct {
+  Path string;                  // conf file, empty if unknown
+  Line int;                     // line in conf file, 0 if unknown
+  Key string;                   // dotted key, empty for the whole file
+  Msg string;                   // detail
+  Err error;                    // one of the Err* of this package
+}
+
+/* value replacing a key of a conf file, from a flag or the environment */
+type Override struct {
+  Key string;                   // dotted key
+  Value string;                 // typed by the field it lands in, as an unquoted YAML value
+  Source string;                // where it comes from, for errors, e.g. "-set" or PPRL_BLOOM_BIT
+}
+
+func (e Error) Error() (string) {
+  return string(e);
+}
+
+func (e *KeyError) Error() (string) {
+  var b strings.Builder;
+  if (*e).Path != "" {
+    b.WriteString((*e).Path);
+    if (*e).Line > 0 {
+      fmt.Fprintf(&b, ":%d", (*e).Line);
+    }
+    b.WriteString(": ");
+  }
+  if (*e).Key != "" {
+    b.WriteString((*e).Key + ": ");
+  }
+  b.WriteString((*e).Err.Error());
+  if (*e).Msg != "" {
+    b.WriteString(" (" + (*e).Msg + ")");
+  }
+  return b.String();
+}
+
+func (e *KeyError) Unwrap() (error) {
+  return (*e).Err;
+}
+
+/*
+  Initiate configuration from a JSON, YAML or TOML file: includes are merged,
+  ${NAME} and ${NAME:-default} are taken from the environment, and keys or
+  values that do not fit conf are rejected
+*/
+func InitConf(path string, conf interface{}) (error) {
+  return InitConfOverride(path, conf, nil);
+}
+
+/* InitConf with keys replaced by override, in order, after includes and before decoding */
+func InitConfOverride(path string, conf interface{}, override []Override) (error) {
+  tree, err := ReadConf(path);
+  if err != nil {
+    return err;
+  }
+  source := make(map[string]string);
+  for _, o := range override {
+    if err = Set(tree, o.Key, o.Value); err != nil {
+      return &KeyError{o.Source, 0, o.Key, err.Error(), ErrInvalidField};
+    }
+    source[o.Key] = o.Source;
+  }
+  err = Decode(tree, conf);
+  if ke, ok := err.(*KeyError); ok && (*ke).Path == "" {
+    /* a bad value is blamed on where it came from */
+    (*ke).Path = path;
+    if s, ok := source[(*ke).Key]; ok {
+      (*ke).Path = s;
+    }
+  }
+  return err;
+}
+
+/* override from "key=value" */
+func ParseOverride(s, source string) (Override, error) {
+  key, value, ok := strings.Cut(s, "=");
+  key = strings.TrimSpace(key);
+  if !ok || key == "" {
+    return Override{}, &KeyError{source, 0, "", strconv.Quote(s) + " should be key=value", ErrInvalidValue};
+  }
+  return Override{key, value, source}, nil;
+}
+
+/*
+  overrides from environment variables named prefix and a top-level key of
+  conf in upper case, e.g. PPRL_BLOOM_BIT for bloom_bit; other variables with
+  the prefix are left alone, they may belong to something else
+*/
+func EnvOverrides(prefix string, conf interface{}) ([]Override) {
+  t := reflect.TypeOf(conf);
+  for t.Kind() == reflect.Ptr {
+    t = t.Elem();
+  }
+  if t.Kind() != reflect.Struct {
+    return nil;
+  }
+  keys := make([]string, 0);
+  for k := range struct_fields(t) {
+    keys = append(keys, k);
+  }
+  sort.Strings(keys);
+  var override []Override;
+  for _, k := range keys {
+    name := prefix + strings.ToUpper(k);
+    if value, ok := os.LookupEnv(name); ok {
+      override = append(override, Override{k, value, name});
+    }
+  }
+  return override;
+}
+
+/* set dotted key of tree to value, tables on the way are made as needed */
+func Set(tree map[string]interface{}, key, value string) (error) {
+  keys := strings.Split(key, ".");
+  for _, k := range keys[:len(keys) - 1] {
+    switch sub := tree[k].(type) {
+    case nil:
+      m := make(map[string]interface{});
+      tree[k] = m;
+      tree = m;
+    case map[string]interface{}:
+      tree = sub;
+    default:
+      return Error(k + " is not a table");
+    }
+  }
+  tree[keys[len(keys) - 1]] = plain(strings.TrimSpace(value));
+  return nil;
+}
+
+/* Format of a conf file from its extension, JSON unless YAML or TOML */
+func Format(path string) (string) {
+  switch strings.ToLower(filepath.Ext(path)) {
+  case ".yaml", ".yml":
+    return FormatYAML;
+  case ".toml":
+    return FormatTOML;
+  }
+  return FormatJSON;
+}
+
+/* Read a conf file into a tree of maps, lists and scalars, with includes and environment resolved */
+func ReadConf(path string) (map[string]interface{}, error) {
+  return read_conf(path, make(map[string]bool), 0);
+}
+
+func read_conf(path string, seen map[string]bool, depth int) (map[string]interface{}, error) {
+  abs, err := filepath.Abs(path);
+  if err != nil {
+    return nil, err;
+  }
+  if seen[abs] || depth > _max_include {
+    return nil, &KeyError{path, 0, IncludeKey, "", ErrInclude};
+  }
+  data, err := os.ReadFile(path);
+  if err != nil {
+    return nil, err;
+  }
+  var tree map[string]interface{};
+  switch Format(path) {
+  case FormatYAML:
+    tree, err = parse_yaml(path, data);
+  case FormatTOML:
+    tree, err = parse_toml(path, data);
+  default:
+    tree, err = parse_json(path, data);
+  }
+  if err != nil {
+    return nil, err;
+  }
+  if err = expand_tree(path, "", tree); err != nil {
+    return nil, err;
+  }
+  include, ok := tree[IncludeKey];
+  if !ok {
+    return tree, nil;
+  }
+  delete(tree, IncludeKey);
+  var files []string;
+  if err = decode_value(IncludeKey, include, reflect.ValueOf(&files).Elem()); err != nil {
+    if s, ok := include.(*scalar); ok && (*s).kind != _scalar_null {
+      files = []string{(*s).text};
+    } else {
+      return nil, &KeyError{path, 0, IncludeKey, "should be a path or a list of paths", ErrInvalidType};
+    }
+  }
+  /* included files first, in order, then this file on top */
+  seen[abs] = true;
+  defer delete(seen, abs);
+  merged := make(map[string]interface{});
+  for _, file := range files {
+    if !filepath.IsAbs(file) {
+      file = filepath.Join(filepath.Dir(path), file);
+    }
+    sub, err := read_conf(file, seen, depth + 1);
+    if err != nil {
+      return nil, err;
+    }
+    merge(merged, sub);
+  }
+  merge(merged, tree);
+  return merged, nil;
+}
+
+/* merge src into dst, tables are merged key by key, anything else replaced */
+func merge(dst, src map[string]interface{}) {
+  for k, v := range src {
+    sub, ok := v.(map[string]interface{});
+    if old, exist := dst[k].(map[string]interface{}); ok && exist {
+      merge(old, sub);
+      continue;
+    }
+    dst[k] = v;
+  }
+}
+
+/* expand environment variables in every string of the tree */
+func expand_tree(path, key string, node interface{}) (error) {
+  switch n := node.(type) {
+  case map[string]interface{}:
+    for k, v := range n {
+      if err := expand_tree(path, join_key(key, k), v); err != nil {
+        return err;
+      }
+    }
+  case []interface{}:
+    for i, v := range n {
+      if err := expand_tree(path, fmt.Sprintf("%s[%d]", key, i), v); err != nil {
+        return err;
+      }
+    }
+  case *scalar:
+    if (*n).kind != _scalar_string && (*n).kind != _scalar_plain {
+      return nil;
+    }
+    text, err := expand_env((*n).text);
+    if err != nil {
+      return &KeyError{path, 0, key, err.Error(), ErrEnv};
+    }
+    (*n).text = text;
+  }
+  return nil;
+}
+
+/* replace ${NAME} and ${NAME:-default}, the default also covers an empty variable */
+func expand_env(text string) (string, error) {
+  if !strings.Contains(text, "${") {
+    return text, nil;
+  }
+  var b strings.Builder;
+  for {
+    start := strings.Index(text, "${");
+    if start < 0 {
+      b.WriteString(text);
+      return b.String(), nil;
+    }
+    end := strings.IndexByte(text[start:], '}');
+    if end < 0 {
+      return "", Error("unterminated ${ in " + strconv.Quote(text));
+    }
+    b.WriteString(text[:start]);
+    name := text[start + 2:start + end];
+    value, set := "", false;
+    if i := strings.Index(name, ":-"); i >= 0 {
+      value, set = os.LookupEnv(name[:i]);
+      if !set || value == "" {
+        value, set = name[i + 2:], true;
+      }
+    } else {
+      value, set = os.LookupEnv(name);
+    }
+    if !set {
+      return "", Error(name + " is not set");
+    }
+    b.WriteString(value);
+    text = text[start + end + 1:];
+  }
+}
+
+/* JSON conf file into a tree */
+func parse_json(path string, data []byte) (map[string]interface{}, error) {
+  decoder := json.NewDecoder(bytes.NewReader(data));
+  decoder.UseNumber();
+  var raw interface{};
+  if err := decoder.Decode(&raw); err != nil {
+    line := 0;
+    if se, ok := err.(*json.SyntaxError); ok {
+      line = bytes.Count(data[:se.Offset], []byte("\n")) + 1;
+    }
+    return nil, &KeyError{path, line, "", err.Error(), ErrSyntax};
+  }
+  if decoder.More() {
+    return nil, &KeyError{path, 0, "", "data after the top-level object", ErrSyntax};
+  }
+  tree, ok := from_json(raw).(map[string]interface{});
+  if !ok {
+    return nil, &KeyError{path, 0, "", "top level should be an object", ErrSyntax};
+  }
+  return tree, nil;
+}
+
+/* decoded JSON into tree nodes */
+func from_json(raw interface{}) (interface{}) {
+  switch v := raw.(type) {
+  case map[string]interface{}:
+    for k, sub := range v {
+      v[k] = from_json(sub);
+    }
+    return v;
+  case []interface{}:
+    for i, sub := range v {
+      v[i] = from_json(sub);
+    }
+    return v;
+  case json.Number:
+    return &scalar{string(v), _scalar_number};
+  case string:
+    return &scalar{v, _scalar_string};
+  case bool:
+    return &scalar{strconv.FormatBool(v), _scalar_bool};
+  }
+  return &scalar{"", _scalar_null};
+}
+
+/* Decode a tree from ReadConf into conf, a pointer; unknown keys and mistyped values are errors */
+func Decode(tree map[string]interface{}, conf interface{}) (error) {
+  v := reflect.ValueOf(conf);
+  if v.Kind() != reflect.Ptr || v.IsNil() {
+    return &KeyError{"", 0, "", "conf should be a non-nil pointer", ErrInvalidType};
+  }
+  return decode_value("", tree, v.Elem());
+}
+
+/* decode node into v, key is the dotted key for errors */
+func decode_value(key string, node interface{}, v reflect.Value) (error) {
+  if s, ok := node.(*scalar); ok && (*s).kind == _scalar_null {
+    v.Set(reflect.Zero(v.Type()));
+    return nil;
+  }
+  mistyped := func() (error) {
+    return &KeyError{"", 0, key, fmt.Sprintf("want %s, got %s", v.Type().String(), describe(node)), ErrInvalidType};
+  };
+  invalid := func(msg string) (error) {
+    return &KeyError{"", 0, key, msg, ErrInvalidValue};
+  };
+  switch v.Kind() {
+  case reflect.Ptr:
+    if v.IsNil() {
+      v.Set(reflect.New(v.Type().Elem()));
+    }
+    return decode_value(key, node, v.Elem());
+  case reflect.Interface:
+    if v.NumMethod() != 0 {
+      return mistyped();
+    }
+    v.Set(reflect.ValueOf(native(node)));
+    return nil;
+  case reflect.Struct:
+    m, ok := node.(map[string]interface{});
+    if !ok {
+      return mistyped();
+    }
+    fields := struct_fields(v.Type());
+    /* sorted, so that the first error is always the same */
+    keys := make([]string, 0, len(m));
+    for k := range m {
+      keys = append(keys, k);
+    }
+    sort.Strings(keys);
+    for _, k := range keys {
+      index, ok := fields[k];
+      if !ok {
+        return &KeyError{"", 0, join_key(key, k), "", ErrInvalidField};
+      }
+      if err := decode_value(join_key(key, k), m[k], v.Field(index)); err != nil {
+        return err;
+      }
+    }
+    return nil;
+  case reflect.Map:
+    m, ok := node.(map[string]interface{});
+    if !ok || v.Type().Key().Kind() != reflect.String {
+      return mistyped();
+    }
+    if v.IsNil() {
+      v.Set(reflect.MakeMap(v.Type()));
+    }
+    for k, sub := range m {
+      elem := reflect.New(v.Type().Elem()).Elem();
+      if err := decode_value(join_key(key, k), sub, elem); err != nil {
+        return err;
+      }
+      v.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), elem);
+    }
+    return nil;
+  case reflect.Slice:
+    list, ok := node.([]interface{});
+    if !ok {
+      return mistyped();
+    }
+    s := reflect.MakeSlice(v.Type(), len(list), len(list));
+    for i, sub := range list {
+      if err := decode_value(fmt.Sprintf("%s[%d]", key, i), sub, s.Index(i)); err != nil {
+        return err;
+      }
+    }
+    v.Set(s);
+    return nil;
+  }
+  s, ok := node.(*scalar);
+  if !ok {
+    return mistyped();
+  }
+  switch v.Kind() {
+  case reflect.String:
+    if (*s).kind != _scalar_string && (*s).kind != _scalar_plain {
+      return mistyped();
+    }
+    v.SetString((*s).text);
+  case reflect.Bool:
+    b, err := strconv.ParseBool((*s).text);
+    if ((*s).kind != _scalar_bool && (*s).kind != _scalar_plain) || err != nil {
+      return mistyped();
+    }
+    v.SetBool(b);
+  case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+    if (*s).kind != _scalar_number && (*s).kind != _scalar_plain {
+      return mistyped();
+    }
+    n, err := strconv.ParseInt((*s).text, 10, v.Type().Bits());
+    if is_range(err) {
+      return invalid((*s).text + " is out of range of " + v.Type().String());
+    }
+    if err != nil {
+      if _, ferr := strconv.ParseFloat((*s).text, 64); ferr != nil {
+        return mistyped();
+      }
+      return invalid((*s).text + " is not an integer of " + v.Type().String());
+    }
+    v.SetInt(n);
+  case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+    if (*s).kind != _scalar_number && (*s).kind != _scalar_plain {
+      return mistyped();
+    }
+    n, err := strconv.ParseUint((*s).text, 10, v.Type().Bits());
+    if is_range(err) {
+      return invalid((*s).text + " is out of range of " + v.Type().String());
+    }
+    if err != nil {
+      if _, ferr := strconv.ParseFloat((*s).text, 64); ferr != nil {
+        return mistyped();
+      }
+      return invalid((*s).text + " is not an integer of " + v.Type().String());
+    }
+    v.SetUint(n);
+  case reflect.Float32, reflect.Float64:
+    if (*s).kind != _scalar_number && (*s).kind != _scalar_plain {
+      return mistyped();
+    }
+    f, err := strconv.ParseFloat((*s).text, v.Type().Bits());
+    if err != nil {
+      if is_range(err) {
+        return invalid((*s).text + " is out of range");
+      }
+      return mistyped();
+    }
+    v.SetFloat(f);
+  default:
+    return mistyped();
+  }
+  return nil;
+}
+
+/* json name to field index, as encoding/json names them */
+func struct_fields(t reflect.Type) (map[string]int) {
+  fields := make(map[string]int);
+  for i := 0; i < t.NumField(); i++ {
+    f := t.Field(i);
+    if f.PkgPath != "" {
+      continue;
+    }
+    name := f.Name;
+    if tag := f.Tag.Get("json"); tag != "" {
+      if tag == "-" {
+        continue;
+      }
+      if n := strings.Split(tag, ",")[0]; n != "" {
+        name = n;
+      }
+    }
+    fields[name] = i;
+  }
+  return fields;
+}
+
+/* tree node as plain Go values */
+func native(node interface{}) (interface{}) {
+  switch n := node.(type) {
+  case map[string]interface{}:
+    m := make(map[string]interface{}, len(n));
+    for k, v := range n {
+      m[k] = native(v);
+    }
+    return m;
+  case []interface{}:
+    l := make([]interface{}, len(n));
+    for i, v := range n {
+      l[i] = native(v);
+    }
+    return l;
+  case *scalar:
+    switch (*n).kind {
+    case _scalar_number:
+      f, _ := strconv.ParseFloat((*n).text, 64);
+      return f;
+    case _scalar_bool:
+      return (*n).text == "true";
+    case _scalar_null:
+      return nil;
+    }
+    return (*n).text;
+  }
+  return nil;
+}
+
+/* kind of a node, for type errors */
+func describe(node interface{}) (string) {
+  switch n := node.(type) {
+  case map[string]interface{}:
+    return "table";
+  case []interface{}:
+    return "list";
+  case *scalar:
+    switch (*n).kind {
+    case _scalar_string:
+      return "string " + strconv.Quote((*n).text);
+    case _scalar_number:
+      return "number " + (*n).text;
+    case _scalar_bool:
+      return "bool " + (*n).text;
+    case _scalar_null:
+      return "null";
+    }
+    return strconv.Quote((*n).text);
+  }
+  return "unknown";
+}
+
+/* dotted key of k under key */
+func join_key(key, k string) (string) {
+  if key == "" {
+    return k;
+  }
+  return key + "." + k;
+}
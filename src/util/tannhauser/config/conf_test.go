@@ -0,0 +1,88 @@
+package config;
+
+import "reflect";
+import "testing";
+
+/* conf text, its tree as plain Go values, or nil if it should be rejected */
+type parse_case struct {
+  text string;
+  want map[string]interface{};
+}
+
+var yaml_cases = []parse_case {
+  {"a: 1\nb: x\n", map[string]interface{}{"a": "1", "b": "x"}},
+  {"a: 'it''s # x'\n", map[string]interface{}{"a": "it's # x"}},
+  {"a: 'it''s' # x\n", map[string]interface{}{"a": "it's"}},
+  {"a: \"# x\" # y\n", map[string]interface{}{"a": "# x"}},
+  {"a: [1, 'b', {c: d}]\n", map[string]interface{}{"a": []interface{}{"1", "b", map[string]interface{}{"c": "d"}}}},
+  {"a:\n  - b: 1\n    c: 2\n", map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": "1", "c": "2"}}}},
+  {"num_field: {\n", nil},
+  {"a: {   \n", nil},
+  {"a: {b\n", nil},
+  {"a: {'b'\n", nil},
+  {"a: ['b\n", nil},
+  {"a: [1, \n", nil},
+  {"a: \"x\\\n", nil},
+  {"a: 1\na: 2\n", nil},
+  {"a: &x 1\n", nil},
+}
+
+var toml_cases = []parse_case {
+  {"a = 1\nb = 'x'\n", map[string]interface{}{"a": float64(1), "b": "x"}},
+  {"[t]\na.b = true\n", map[string]interface{}{"t": map[string]interface{}{"a": map[string]interface{}{"b": true}}}},
+  {"a = [1,\n  2]\n", map[string]interface{}{"a": []interface{}{float64(1), float64(2)}}},
+  {"a = {b = \"c\"}\n", map[string]interface{}{"a": map[string]interface{}{"b": "c"}}},
+  {"a = {\n", nil},
+  {"a = [1,\n", nil},
+  {"a = \"x\n", nil},
+  {"a = '''x\n", nil},
+  {"[t\n", nil},
+  {"a = 1\na = 2\n", nil},
+  {"a =\n", nil},
+}
+
+func check_parse(t *testing.T, name string, parse func(string, []byte) (map[string]interface{}, error), cases []parse_case) {
+  for _, c := range cases {
+    tree, err := parse(name, []byte(c.text));
+    if c.want == nil {
+      if err == nil {
+        t.Errorf("%q: expected an error, got %v", c.text, native(tree));
+      }
+      continue;
+    }
+    if err != nil {
+      t.Errorf("%q: %s", c.text, err.Error());
+      continue;
+    }
+    if got := native(tree); !reflect.DeepEqual(got, c.want) {
+      t.Errorf("%q: got %v, want %v", c.text, got, c.want);
+    }
+  }
+}
+
+func TestParseYAML(t *testing.T) {
+  check_parse(t, "test.yaml", parse_yaml, yaml_cases);
+}
+
+func TestParseTOML(t *testing.T) {
+  check_parse(t, "test.toml", parse_toml, toml_cases);
+}
+
+/* parsers only return errors, whatever the input */
+func FuzzYAML(f *testing.F) {
+  for _, c := range yaml_cases {
+    f.Add(c.text);
+  }
+  f.Fuzz(func(t *testing.T, text string) {
+    parse_yaml("fuzz.yaml", []byte(text));
+  });
+}
+
+func FuzzTOML(f *testing.F) {
+  for _, c := range toml_cases {
+    f.Add(c.text);
+  }
+  f.Fuzz(func(t *testing.T, text string) {
+    parse_toml("fuzz.toml", []byte(text));
+  });
+}
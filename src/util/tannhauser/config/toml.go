@@ -0,0 +1,456 @@
+package config;
+
+import "strconv";
+import "strings";
+
+/*
+  TOML subset enough for conf files: key = value with bare, quoted and dotted
+  keys, [table] and [[array of tables]], basic and literal strings (also
+  multi-line), integers (with _, 0x, 0o, 0b), floats, booleans, arrays over
+  several lines and inline tables; dates are kept as strings
+*/
+
+type toml_parser struct {
+  path string;
+  text string;
+  pos int;
+  line int;                     // line of pos, from 1
+  root map[string]interface{};
+  table map[string]interface{}; // table under the last header
+  defined map[string]bool;      // tables with a header of their own
+}
+
+/* TOML conf file into a tree */
+func parse_toml(path string, data []byte) (map[string]interface{}, error) {
+  p := &toml_parser {
+    path: path,
+    text: strings.ReplaceAll(string(data), "\r\n", "\n"),
+    line: 1,
+    root: make(map[string]interface{}),
+    defined: make(map[string]bool),
+  };
+  (*p).table = (*p).root;
+  for {
+    p.skip_space(true);
+    if (*p).pos >= len((*p).text) {
+      return (*p).root, nil;
+    }
+    var err error;
+    if (*p).text[(*p).pos] == '[' {
+      err = p.header();
+    } else {
+      err = p.pair((*p).table);
+    }
+    if err == nil {
+      err = p.end_line();
+    }
+    if err != nil {
+      return nil, err;
+    }
+  }
+}
+
+/* [table] or [[array of tables]] */
+func (p *toml_parser) header() (error) {
+  array := strings.HasPrefix((*p).text[(*p).pos:], "[[");
+  if array {
+    (*p).pos += 2;
+  } else {
+    (*p).pos++;
+  }
+  keys, err := p.key();
+  if err != nil {
+    return err;
+  }
+  close := "]";
+  if array {
+    close = "]]";
+  }
+  p.skip_space(false);
+  if !strings.HasPrefix((*p).text[(*p).pos:], close) {
+    return p.fail("expected " + strconv.Quote(close));
+  }
+  (*p).pos += len(close);
+  parent, err := p.descend((*p).root, keys[:len(keys) - 1]);
+  if err != nil {
+    return err;
+  }
+  last := keys[len(keys) - 1];
+  name := strings.Join(keys, ".");
+  if array {
+    list, ok := parent[last].([]interface{});
+    if !ok && parent[last] != nil {
+      return p.fail(name + " is not an array of tables");
+    }
+    (*p).table = make(map[string]interface{});
+    parent[last] = append(list, (*p).table);
+    return nil;
+  }
+  if (*p).defined[name] {
+    return p.fail("table " + name + " defined twice");
+  }
+  (*p).defined[name] = true;
+  if (*p).table, err = p.descend(parent, []string{last}); err != nil {
+    return err;
+  }
+  return nil;
+}
+
+/* key = value into table */
+func (p *toml_parser) pair(table map[string]interface{}) (error) {
+  keys, err := p.key();
+  if err != nil {
+    return err;
+  }
+  p.skip_space(false);
+  if (*p).pos >= len((*p).text) || (*p).text[(*p).pos] != '=' {
+    return p.fail("expected \"=\" after key");
+  }
+  (*p).pos++;
+  p.skip_space(false);
+  v, err := p.value();
+  if err != nil {
+    return err;
+  }
+  parent, err := p.descend(table, keys[:len(keys) - 1]);
+  if err != nil {
+    return err;
+  }
+  last := keys[len(keys) - 1];
+  if _, ok := parent[last]; ok {
+    return p.fail("duplicate key " + strings.Join(keys, "."));
+  }
+  parent[last] = v;
+  return nil;
+}
+
+/* table at keys under table, made as needed; an array of tables stands for its last table */
+func (p *toml_parser) descend(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+  for _, k := range keys {
+    switch sub := table[k].(type) {
+    case nil:
+      m := make(map[string]interface{});
+      table[k] = m;
+      table = m;
+    case map[string]interface{}:
+      table = sub;
+    case []interface{}:
+      m, ok := sub[len(sub) - 1].(map[string]interface{});
+      if !ok {
+        return nil, p.fail(k + " is not a table");
+      }
+      table = m;
+    default:
+      return nil, p.fail(k + " is not a table");
+    }
+  }
+  return table, nil;
+}
+
+/* dotted key, parts bare or quoted */
+func (p *toml_parser) key() ([]string, error) {
+  var keys []string;
+  for {
+    p.skip_space(false);
+    if (*p).pos >= len((*p).text) {
+      return nil, p.fail("expected key");
+    }
+    switch c := (*p).text[(*p).pos]; {
+    case c == '"' || c == '\'':
+      k, err := p.string();
+      if err != nil {
+        return nil, err;
+      }
+      keys = append(keys, k);
+    default:
+      start := (*p).pos;
+      for (*p).pos < len((*p).text) && is_bare((*p).text[(*p).pos]) {
+        (*p).pos++;
+      }
+      if start == (*p).pos {
+        return nil, p.fail("expected key");
+      }
+      keys = append(keys, (*p).text[start:(*p).pos]);
+    }
+    p.skip_space(false);
+    if (*p).pos >= len((*p).text) || (*p).text[(*p).pos] != '.' {
+      return keys, nil;
+    }
+    (*p).pos++;
+  }
+}
+
+/* value at pos */
+func (p *toml_parser) value() (interface{}, error) {
+  if (*p).pos >= len((*p).text) {
+    return nil, p.fail("expected value");
+  }
+  switch (*p).text[(*p).pos] {
+  case '"', '\'':
+    s, err := p.string();
+    if err != nil {
+      return nil, err;
+    }
+    return &scalar{s, _scalar_string}, nil;
+  case '[':
+    (*p).pos++;
+    list := make([]interface{}, 0);
+    for {
+      p.skip_space(true);
+      if (*p).pos < len((*p).text) && (*p).text[(*p).pos] == ']' {
+        (*p).pos++;
+        return list, nil;
+      }
+      v, err := p.value();
+      if err != nil {
+        return nil, err;
+      }
+      list = append(list, v);
+      p.skip_space(true);
+      if (*p).pos < len((*p).text) && (*p).text[(*p).pos] == ',' {
+        (*p).pos++;
+      } else if (*p).pos >= len((*p).text) || (*p).text[(*p).pos] != ']' {
+        return nil, p.fail("expected \",\" or \"]\" in array");
+      }
+    }
+  case '{':
+    (*p).pos++;
+    m := make(map[string]interface{});
+    p.skip_space(false);
+    if (*p).pos < len((*p).text) && (*p).text[(*p).pos] == '}' {
+      (*p).pos++;
+      return m, nil;
+    }
+    for {
+      if err := p.pair(m); err != nil {
+        return nil, err;
+      }
+      p.skip_space(false);
+      if (*p).pos >= len((*p).text) {
+        return nil, p.fail("unterminated inline table");
+      }
+      c := (*p).text[(*p).pos];
+      (*p).pos++;
+      if c == '}' {
+        return m, nil;
+      }
+      if c != ',' {
+        return nil, p.fail("expected \",\" or \"}\" in inline table");
+      }
+    }
+  }
+  start := (*p).pos;
+  for (*p).pos < len((*p).text) && strings.IndexByte(" \t\n,]}#", (*p).text[(*p).pos]) < 0 {
+    (*p).pos++;
+  }
+  /* a date and time may hold one space */
+  if (*p).pos + 1 < len((*p).text) && (*p).text[(*p).pos] == ' ' && is_date((*p).text[start:(*p).pos]) && is_digit((*p).text[(*p).pos + 1]) {
+    (*p).pos++;
+    for (*p).pos < len((*p).text) && strings.IndexByte(" \t\n,]}#", (*p).text[(*p).pos]) < 0 {
+      (*p).pos++;
+    }
+  }
+  token := (*p).text[start:(*p).pos];
+  switch {
+  case token == "true" || token == "false":
+    return &scalar{token, _scalar_bool}, nil;
+  case is_date(token):
+    return &scalar{token, _scalar_string}, nil;
+  }
+  if number, ok := toml_number(token); ok {
+    return &scalar{number, _scalar_number}, nil;
+  }
+  return nil, p.fail("invalid value " + strconv.Quote(token));
+}
+
+/* basic, literal or multi-line string at pos */
+func (p *toml_parser) string() (string, error) {
+  q := (*p).text[(*p).pos];
+  triple := strings.Repeat(string(q), 3);
+  if strings.HasPrefix((*p).text[(*p).pos:], triple) {
+    (*p).pos += 3;
+    end := strings.Index((*p).text[(*p).pos:], triple);
+    if end < 0 {
+      return "", p.fail("unterminated multi-line string");
+    }
+    /* up to two quotes right before the closing ones belong to the string */
+    for extra := 0; extra < 2 && (*p).pos + end + 3 < len((*p).text) && (*p).text[(*p).pos + end + 3] == q; extra++ {
+      end++;
+    }
+    body := strings.TrimPrefix((*p).text[(*p).pos:(*p).pos + end], "\n");
+    (*p).line += strings.Count((*p).text[(*p).pos:(*p).pos + end + 3], "\n");
+    (*p).pos += end + 3;
+    if q == '\'' {
+      return body, nil;
+    }
+    return toml_unescape(body, p);
+  }
+  if q == '\'' {
+    end := strings.IndexAny((*p).text[(*p).pos + 1:], "'\n");
+    if end < 0 || (*p).text[(*p).pos + 1 + end] != '\'' {
+      return "", p.fail("unterminated string");
+    }
+    s := (*p).text[(*p).pos + 1:(*p).pos + 1 + end];
+    (*p).pos += end + 2;
+    return s, nil;
+  }
+  for n := (*p).pos + 1; n < len((*p).text); n++ {
+    switch (*p).text[n] {
+    case '\\':
+      n++;
+    case '\n':
+      return "", p.fail("unterminated string");
+    case '"':
+      s := (*p).text[(*p).pos + 1:n];
+      (*p).pos = n + 1;
+      return toml_unescape(s, p);
+    }
+  }
+  return "", p.fail("unterminated string");
+}
+
+/* skip spaces and, with newline, comments and line breaks too */
+func (p *toml_parser) skip_space(newline bool) {
+  for (*p).pos < len((*p).text) {
+    switch (*p).text[(*p).pos] {
+    case ' ', '\t':
+      (*p).pos++;
+    case '\n':
+      if !newline {
+        return;
+      }
+      (*p).line++;
+      (*p).pos++;
+    case '#':
+      if !newline {
+        return;
+      }
+      for (*p).pos < len((*p).text) && (*p).text[(*p).pos] != '\n' {
+        (*p).pos++;
+      }
+    default:
+      return;
+    }
+  }
+}
+
+/* only a comment may follow on the line */
+func (p *toml_parser) end_line() (error) {
+  p.skip_space(false);
+  if (*p).pos < len((*p).text) && (*p).text[(*p).pos] == '#' {
+    for (*p).pos < len((*p).text) && (*p).text[(*p).pos] != '\n' {
+      (*p).pos++;
+    }
+  }
+  if (*p).pos < len((*p).text) && (*p).text[(*p).pos] != '\n' {
+    return p.fail("unexpected " + strconv.Quote((*p).text[(*p).pos:(*p).pos + 1]) + " after value");
+  }
+  return nil;
+}
+
+func (p *toml_parser) fail(msg string) (error) {
+  return &KeyError{(*p).path, (*p).line, "", msg, ErrSyntax};
+}
+
+/* escapes of a basic string */
+func toml_unescape(s string, p *toml_parser) (string, error) {
+  if strings.IndexByte(s, '\\') < 0 {
+    return s, nil;
+  }
+  var b strings.Builder;
+  for i := 0; i < len(s); i++ {
+    if s[i] != '\\' {
+      b.WriteByte(s[i]);
+      continue;
+    }
+    i++;
+    if i >= len(s) {
+      return "", p.fail("unterminated escape");
+    }
+    switch s[i] {
+    case 'b':
+      b.WriteByte('\b');
+    case 't':
+      b.WriteByte('\t');
+    case 'n':
+      b.WriteByte('\n');
+    case 'f':
+      b.WriteByte('\f');
+    case 'r':
+      b.WriteByte('\r');
+    case '"', '\\':
+      b.WriteByte(s[i]);
+    case 'u', 'U':
+      n := 4;
+      if s[i] == 'U' {
+        n = 8;
+      }
+      if i + n >= len(s) {
+        return "", p.fail("short unicode escape");
+      }
+      r, err := strconv.ParseUint(s[i + 1:i + 1 + n], 16, 32);
+      if err != nil {
+        return "", p.fail("bad unicode escape");
+      }
+      b.WriteRune(rune(r));
+      i += n;
+    case '\n', ' ', '\t':
+      /* line ending backslash trims the following whitespace */
+      for i < len(s) && strings.IndexByte(" \t\n", s[i]) >= 0 {
+        i++;
+      }
+      i--;
+    default:
+      return "", p.fail("unknown escape \\" + string(s[i]));
+    }
+  }
+  return b.String(), nil;
+}
+
+/* integer as decimal text, float as is, ok false if token is no number */
+func toml_number(token string) (string, bool) {
+  t := strings.ReplaceAll(token, "_", "");
+  if t == "" || strings.HasPrefix(token, "_") || strings.HasSuffix(token, "_") || strings.Contains(token, "__") {
+    return "", false;
+  }
+  switch strings.TrimLeft(t, "+-") {
+  case "inf", "nan":
+    return t, true;
+  }
+  if strings.HasPrefix(t, "0x") || strings.HasPrefix(t, "0o") || strings.HasPrefix(t, "0b") {
+    n, err := strconv.ParseUint(t, 0, 64);
+    if err != nil {
+      return "", false;
+    }
+    return strconv.FormatUint(n, 10), true;
+  }
+  if _, err := strconv.ParseInt(t, 10, 64); err == nil {
+    return strings.TrimPrefix(t, "+"), true;
+  }
+  if _, err := strconv.ParseFloat(t, 64); err == nil || is_range(err) {
+    return strings.TrimPrefix(t, "+"), true;
+  }
+  return "", false;
+}
+
+/* whether err is a number out of range, which the decoder reports by key */
+func is_range(err error) (bool) {
+  e, ok := err.(*strconv.NumError);
+  return ok && (*e).Err == strconv.ErrRange;
+}
+
+/* whether token looks like a date or time, which is not a number */
+func is_date(token string) (bool) {
+  if len(token) < 8 || !is_digit(token[0]) {
+    return false;
+  }
+  return (len(token) >= 10 && token[4] == '-' && token[7] == '-') || (token[2] == ':' && token[5] == ':');
+}
+
+func is_digit(c byte) (bool) {
+  return c >= '0' && c <= '9';
+}
+
+func is_bare(c byte) (bool) {
+  return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || is_digit(c) || c == '_' || c == '-';
+}
@@ -0,0 +1,414 @@
+package config;
+
+import "strconv";
+import "strings";
+
+/*
+  YAML subset enough for conf files: block mappings and sequences by
+  indentation, flow [..] and {..} on one line, plain, single and double
+  quoted scalars, comments and a leading "---"; anchors, tags and block
+  scalars (| and >) are rejected
+*/
+
+/* line of a YAML file without comment and trailing space */
+type yaml_line struct {
+  no int;                       // line number, from 1
+  indent int;                   // #leading space
+  text string;
+}
+
+type yaml_parser struct {
+  path string;
+  line []*yaml_line;
+  pos int;                      // next line
+}
+
+/* YAML conf file into a tree */
+func parse_yaml(path string, data []byte) (map[string]interface{}, error) {
+  p := &yaml_parser{path: path};
+  for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+    text := strings.TrimRight(strip_comment(raw), " \t");
+    body := strings.TrimLeft(text, " ");
+    if body == "" {
+      continue;
+    }
+    if strings.HasPrefix(body, "\t") {
+      return nil, p.fail(i + 1, "tab in indentation");
+    }
+    if text == "---" {
+      if len((*p).line) > 0 {
+        return nil, p.fail(i + 1, "only one document is supported");
+      }
+      continue;
+    }
+    if text == "..." {
+      break;
+    }
+    (*p).line = append((*p).line, &yaml_line{i + 1, len(text) - len(body), body});
+  }
+  if len((*p).line) == 0 {
+    return make(map[string]interface{}), nil;
+  }
+  if (*(*p).line[0]).indent != 0 || is_item((*(*p).line[0]).text) {
+    return nil, p.fail((*(*p).line[0]).no, "top level should be a mapping");
+  }
+  tree, err := p.mapping(0);
+  if err != nil {
+    return nil, err;
+  }
+  if (*p).pos < len((*p).line) {
+    return nil, p.fail((*(*p).line[(*p).pos]).no, "bad indentation");
+  }
+  return tree, nil;
+}
+
+/* block mapping of lines at indent */
+func (p *yaml_parser) mapping(indent int) (map[string]interface{}, error) {
+  m := make(map[string]interface{});
+  for (*p).pos < len((*p).line) {
+    l := (*p).line[(*p).pos];
+    if (*l).indent < indent {
+      break;
+    }
+    if (*l).indent > indent || is_item((*l).text) {
+      return nil, p.fail((*l).no, "bad indentation");
+    }
+    key, rest, err := split_key((*l).text);
+    if err != nil {
+      return nil, p.fail((*l).no, err.Error());
+    }
+    if _, ok := m[key]; ok {
+      return nil, p.fail((*l).no, "duplicate key " + strconv.Quote(key));
+    }
+    (*p).pos++;
+    if m[key], err = p.value(l, rest); err != nil {
+      return nil, err;
+    }
+  }
+  return m, nil;
+}
+
+/* block sequence of lines at indent */
+func (p *yaml_parser) sequence(indent int) ([]interface{}, error) {
+  list := make([]interface{}, 0);
+  for (*p).pos < len((*p).line) {
+    l := (*p).line[(*p).pos];
+    if (*l).indent < indent || ((*l).indent == indent && !is_item((*l).text)) {
+      break;
+    }
+    if (*l).indent > indent {
+      return nil, p.fail((*l).no, "bad indentation");
+    }
+    rest := strings.TrimLeft((*l).text[1:], " ");
+    if rest != "" && !is_flow(rest) && !is_quoted_scalar(rest) {
+      if _, _, err := split_key(rest); err == nil {
+        /* "- key: value" opens a mapping indented as its first key */
+        (*p).line[(*p).pos] = &yaml_line{(*l).no, indent + len((*l).text) - len(rest), rest};
+        m, err := p.mapping((*(*p).line[(*p).pos]).indent);
+        if err != nil {
+          return nil, err;
+        }
+        list = append(list, m);
+        continue;
+      }
+    }
+    (*p).pos++;
+    v, err := p.value(l, rest);
+    if err != nil {
+      return nil, err;
+    }
+    list = append(list, v);
+  }
+  return list, nil;
+}
+
+/* value after "key:" or "-" of line l, a nested block if rest is empty */
+func (p *yaml_parser) value(l *yaml_line, rest string) (interface{}, error) {
+  if rest != "" {
+    if strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">") {
+      return nil, p.fail((*l).no, "block scalars are not supported");
+    }
+    if strings.HasPrefix(rest, "&") || strings.HasPrefix(rest, "*") || strings.HasPrefix(rest, "!") {
+      return nil, p.fail((*l).no, "anchors, aliases and tags are not supported");
+    }
+    v, n, err := flow_value(rest, 0, false);
+    if err == nil && strings.TrimSpace(rest[n:]) != "" {
+      err = Error("unexpected " + strconv.Quote(strings.TrimSpace(rest[n:])));
+    }
+    if err != nil {
+      return nil, p.fail((*l).no, err.Error());
+    }
+    return v, nil;
+  }
+  if (*p).pos >= len((*p).line) {
+    return &scalar{"", _scalar_null}, nil;
+  }
+  next := (*p).line[(*p).pos];
+  switch {
+  case (*next).indent > (*l).indent && is_item((*next).text):
+    return p.sequence((*next).indent);
+  case (*next).indent > (*l).indent:
+    return p.mapping((*next).indent);
+  case (*next).indent == (*l).indent && is_item((*next).text) && !is_item((*l).text):
+    /* a sequence may sit at the indent of its key */
+    return p.sequence((*next).indent);
+  }
+  return &scalar{"", _scalar_null}, nil;
+}
+
+func (p *yaml_parser) fail(line int, msg string) (error) {
+  return &KeyError{(*p).path, line, "", msg, ErrSyntax};
+}
+
+/* whether text is a sequence item */
+func is_item(text string) (bool) {
+  return text == "-" || strings.HasPrefix(text, "- ");
+}
+
+func is_flow(text string) (bool) {
+  return strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{");
+}
+
+/* whether text is a quoted scalar and nothing else */
+func is_quoted_scalar(text string) (bool) {
+  if !strings.HasPrefix(text, "\"") && !strings.HasPrefix(text, "'") {
+    return false;
+  }
+  _, n, err := quoted(text, 0);
+  return err == nil && strings.TrimSpace(text[n:]) == "";
+}
+
+/* key and the rest after "key:" */
+func split_key(text string) (string, string, error) {
+  if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+    key, n, err := quoted(text, 0);
+    if err != nil {
+      return "", "", err;
+    }
+    rest := strings.TrimLeft(text[n:], " ");
+    if !strings.HasPrefix(rest, ":") || (len(rest) > 1 && rest[1] != ' ') {
+      return "", "", Error("expected \":\" after key");
+    }
+    return key, strings.TrimSpace(rest[1:]), nil;
+  }
+  for i := 0; i < len(text); i++ {
+    if text[i] == ':' && (i + 1 == len(text) || text[i + 1] == ' ') {
+      key := strings.TrimSpace(text[:i]);
+      if key == "" {
+        return "", "", Error("empty key");
+      }
+      return key, strings.TrimSpace(text[i + 1:]), nil;
+    }
+  }
+  return "", "", Error("expected \"key: value\"");
+}
+
+/*
+  scalar or flow collection starting at text[i], returns the end; in a flow
+  collection plain scalars also end at "," "]" "}"
+*/
+func flow_value(text string, i int, in_flow bool) (interface{}, int, error) {
+  for i < len(text) && text[i] == ' ' {
+    i++;
+  }
+  if i >= len(text) {
+    return &scalar{"", _scalar_null}, i, nil;
+  }
+  switch text[i] {
+  case '"', '\'':
+    s, n, err := quoted(text, i);
+    if err != nil {
+      return nil, 0, err;
+    }
+    return &scalar{s, _scalar_string}, n, nil;
+  case '[':
+    list := make([]interface{}, 0);
+    i++;
+    for {
+      for i < len(text) && text[i] == ' ' {
+        i++;
+      }
+      if i < len(text) && text[i] == ']' {
+        return list, i + 1, nil;
+      }
+      v, n, err := flow_value(text, i, true);
+      if err != nil {
+        return nil, 0, err;
+      }
+      list = append(list, v);
+      if i, err = flow_next(text, n, ']'); err != nil {
+        return nil, 0, err;
+      }
+      if text[i - 1] == ']' {
+        return list, i, nil;
+      }
+    }
+  case '{':
+    m := make(map[string]interface{});
+    i++;
+    for {
+      for i < len(text) && text[i] == ' ' {
+        i++;
+      }
+      if i < len(text) && text[i] == '}' {
+        return m, i + 1, nil;
+      }
+      key, n, err := flow_key(text, i);
+      if err != nil {
+        return nil, 0, err;
+      }
+      if _, ok := m[key]; ok {
+        return nil, 0, Error("duplicate key " + strconv.Quote(key));
+      }
+      v, n, err := flow_value(text, n, true);
+      if err != nil {
+        return nil, 0, err;
+      }
+      m[key] = v;
+      if i, err = flow_next(text, n, '}'); err != nil {
+        return nil, 0, err;
+      }
+      if text[i - 1] == '}' {
+        return m, i, nil;
+      }
+    }
+  }
+  end := len(text);
+  if in_flow {
+    if n := strings.IndexAny(text[i:], ",]}"); n >= 0 {
+      end = i + n;
+    }
+  }
+  return plain(strings.TrimSpace(text[i:end])), end, nil;
+}
+
+/* key of a flow mapping up to and past ":" */
+func flow_key(text string, i int) (string, int, error) {
+  if i >= len(text) {
+    return "", 0, Error("unterminated flow mapping");
+  }
+  if text[i] == '"' || text[i] == '\'' {
+    key, n, err := quoted(text, i);
+    if err != nil {
+      return "", 0, err;
+    }
+    for n < len(text) && text[n] == ' ' {
+      n++;
+    }
+    if n >= len(text) || text[n] != ':' {
+      return "", 0, Error("expected \":\" after key");
+    }
+    return key, n + 1, nil;
+  }
+  for n := i; n < len(text); n++ {
+    switch text[n] {
+    case ':':
+      if key := strings.TrimSpace(text[i:n]); key != "" {
+        return key, n + 1, nil;
+      }
+      return "", 0, Error("empty key");
+    case ',', '}', ']':
+      return "", 0, Error("expected \":\" after key");
+    }
+  }
+  return "", 0, Error("unterminated flow mapping");
+}
+
+/* skip past "," or the closing bracket after a flow item */
+func flow_next(text string, i int, end byte) (int, error) {
+  for i < len(text) && text[i] == ' ' {
+    i++;
+  }
+  if i >= len(text) {
+    return 0, Error("unterminated flow collection, it should close on the same line");
+  }
+  if text[i] != ',' && text[i] != end {
+    return 0, Error("expected \",\" or \"" + string(end) + "\"");
+  }
+  return i + 1, nil;
+}
+
+/* quoted scalar starting at text[i], returns the value and the end */
+func quoted(text string, i int) (string, int, error) {
+  if i >= len(text) {
+    return "", 0, Error("unterminated quoted string");
+  }
+  q := text[i];
+  var b strings.Builder;
+  for n := i + 1; n < len(text); n++ {
+    c := text[n];
+    switch {
+    case c == q && q == '\'' && n + 1 < len(text) && text[n + 1] == '\'':
+      b.WriteByte('\'');
+      n++;
+    case c == q:
+      return b.String(), n + 1, nil;
+    case c == '\\' && q == '"':
+      if n + 1 >= len(text) {
+        return "", 0, Error("unterminated escape");
+      }
+      n++;
+      switch text[n] {
+      case 'n':
+        b.WriteByte('\n');
+      case 't':
+        b.WriteByte('\t');
+      case 'r':
+        b.WriteByte('\r');
+      case '0':
+        b.WriteByte(0);
+      case '"', '\\', '/':
+        b.WriteByte(text[n]);
+      case 'u':
+        if n + 4 >= len(text) {
+          return "", 0, Error("short \\u escape");
+        }
+        r, err := strconv.ParseUint(text[n + 1:n + 5], 16, 32);
+        if err != nil {
+          return "", 0, Error("bad \\u escape");
+        }
+        b.WriteRune(rune(r));
+        n += 4;
+      default:
+        return "", 0, Error("unknown escape \\" + string(text[n]));
+      }
+    default:
+      b.WriteByte(c);
+    }
+  }
+  return "", 0, Error("unterminated quoted string");
+}
+
+/* plain scalar, null and ~ are null, the rest is typed when decoded */
+func plain(text string) (*scalar) {
+  switch text {
+  case "", "~", "null", "Null", "NULL":
+    return &scalar{"", _scalar_null};
+  }
+  return &scalar{text, _scalar_plain};
+}
+
+/* drop a comment, "#" at line start or after a space and outside quotes */
+func strip_comment(line string) (string) {
+  var q byte;
+  for i := 0; i < len(line); i++ {
+    c := line[i];
+    switch {
+    case q == '"' && c == '\\':
+      i++;
+    case q == '\'' && c == q && i + 1 < len(line) && line[i + 1] == q:
+      /* '' is an escaped quote inside single quotes */
+      i++;
+    case q != 0:
+      if c == q {
+        q = 0;
+      }
+    case c == '#' && (i == 0 || line[i - 1] == ' ' || line[i - 1] == '\t'):
+      return line[:i];
+    case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" :[{,-", line[i - 1]) >= 0):
+      /* a quote only opens at the start of a scalar, as in "it's" it does not */
+      q = c;
+    }
+  }
+  return line;
+}
@@ -106,3 +106,13 @@ func Ui64ToB(input uint64) ([]byte){
   return output
 }
 
+
+// tannhauser, write an uint32 into the first 4 bytes of output, little endian
+func PutUi32L(output []byte, input uint32) {
+  binary.LittleEndian.PutUint32(output, input)
+}
+
+// tannhauser, write an uint64 into the first 8 bytes of output, little endian
+func PutUi64L(output []byte, input uint64) {
+  binary.LittleEndian.PutUint64(output, input)
+}
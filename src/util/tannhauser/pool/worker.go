@@ -0,0 +1,123 @@
+package pool;
+
+import "context";
+import "sync";
+
+/* #batch per worker when chunk size is decided automatically */
+const _batch_per_worker = 4;
+
+/* fixed number of workers processing index ranges in batches */
+type WorkerPool struct {
+  size int;
+  chunk int;
+}
+
+/* chunk <= 0 sizes batches from n and #worker on each run */
+func (p *WorkerPool) InitWorkerPool(size, chunk int) {
+  if size <= 0 {
+    size = 1;
+  }
+  p.size = size;
+  p.chunk = chunk;
+  return;
+}
+
+func (p *WorkerPool) Size() (int) {
+  return p.size;
+}
+
+/* run fn on [0, n) with the configured chunk size, return when all batches are done */
+func (p *WorkerPool) Run(n int, fn func(start, end int)) {
+  p.RunChunk(n, p.chunk, fn);
+}
+
+/* run fn on [0, n) in batches of chunk items */
+func (p *WorkerPool) RunChunk(n, chunk int, fn func(start, end int)) {
+  p.RunChunkContext(context.Background(), n, chunk, fn);
+}
+
+/* run fn on [0, n) with the configured chunk size until ctx is done */
+func (p *WorkerPool) RunContext(ctx context.Context, n int, fn func(start, end int)) (error) {
+  return p.RunChunkContext(ctx, n, p.chunk, fn);
+}
+
+/*
+  run fn on [0, n) in batches of chunk items, no batch is dispatched after ctx
+  is done; a panic in fn stops further batches and is raised again here, in
+  the caller, where it can be recovered
+*/
+func (p *WorkerPool) RunChunkContext(ctx context.Context, n, chunk int, fn func(start, end int)) (error) {
+  if n <= 0 {
+    return ctx.Err();
+  }
+  if chunk <= 0 {
+    chunk = n / (p.size * _batch_per_worker);
+    if chunk <= 0 {
+      chunk = 1;
+    }
+  }
+  worker := p.size;
+  if batches := (n + chunk - 1) / chunk; batches < worker {
+    worker = batches;
+  }
+  start := make(chan int, worker);
+  var wg sync.WaitGroup;
+  var failure panic_value;
+  for i := 0; i < worker; i++ {
+    wg.Add(1);
+    go func() {
+      defer wg.Done();
+      for s := range start {
+        e := s + chunk;
+        if e > n {
+          e = n;
+        }
+        if !failure.failed() {
+          run_batch(fn, s, e, &failure);
+        }
+      }
+    } ();
+  }
+  dispatch:
+  for s := 0; s < n; s += chunk {
+    select {
+    case <- ctx.Done():
+      break dispatch;
+    case start <- s:
+    }
+  }
+  close(start);
+  wg.Wait();
+  if failure.failed() {
+    panic(failure.value);
+  }
+  return ctx.Err();
+}
+
+/* first panic of the batches of a run */
+type panic_value struct {
+  mutex sync.Mutex;             // guards value and set, batches run concurrently
+  value interface{};            // recovered value
+  set bool;                     // a batch panicked
+}
+
+/* whether a batch panicked */
+func (p *panic_value) failed() (bool) {
+  (*p).mutex.Lock();
+  defer (*p).mutex.Unlock();
+  return (*p).set;
+}
+
+/* run a batch, a panic is kept instead of killing the process from a worker */
+func run_batch(fn func(start, end int), s, e int, failure *panic_value) {
+  defer func() {
+    if r := recover(); r != nil {
+      (*failure).mutex.Lock();
+      if !(*failure).set {
+        (*failure).value, (*failure).set = r, true;
+      }
+      (*failure).mutex.Unlock();
+    }
+  } ();
+  fn(s, e);
+}